@@ -0,0 +1,175 @@
+package cc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&StaticAnalyzerReport{})
+	core.AssertIsReportTarget(&StaticAnalyzerReport{})
+	core.AssertIsBuildableTarget(&IwyuReport{})
+	core.AssertIsReportTarget(&IwyuReport{})
+}
+
+var clangAnalyzerFlag = core.StringFlag{
+	Name:        "cc-clang-analyzer",
+	Description: "Clang compiler driver used to run the static analyzer for cc.StaticAnalyzerReport targets",
+	DefaultFn:   func() string { return "clang" },
+}.Register()
+
+var iwyuFlag = core.StringFlag{
+	Name:        "cc-iwyu",
+	Description: "include-what-you-use binary used for cc.IwyuReport targets",
+	DefaultFn:   func() string { return "include-what-you-use" },
+}.Register()
+
+// analysisTargets returns the targets among the given ones that support static analysis.
+func analysisTargets(targets []interface{}) []core.AnalyzeInterface {
+	result := []core.AnalyzeInterface{}
+	for _, target := range targets {
+		if iface, ok := target.(core.AnalyzeInterface); ok {
+			result = append(result, iface)
+		}
+	}
+	return result
+}
+
+// collectTranslationUnits returns the C and C++ translation units of the given targets
+// and of all their analysis dependencies. Each object file is reported only once, and
+// assembly sources are skipped.
+func collectTranslationUnits(ctx core.Context, targets []core.AnalyzeInterface) []core.TranslationUnit {
+	result := []core.TranslationUnit{}
+	seen := map[string]bool{}
+
+	var collect func(target core.AnalyzeInterface)
+	collect = func(target core.AnalyzeInterface) {
+		for _, unit := range target.TranslationUnits(ctx) {
+			if seen[unit.Object.Relative()] {
+				continue
+			}
+			seen[unit.Object.Relative()] = true
+
+			switch filepath.Ext(unit.Source.Relative()) {
+			case ".S", ".sx", ".s":
+				continue
+			}
+			result = append(result, unit)
+		}
+		for _, dep := range target.AnalysisDeps(ctx) {
+			collect(dep)
+		}
+	}
+
+	for _, target := range targets {
+		collect(target)
+	}
+	return result
+}
+
+// StaticAnalyzerReport runs the clang static analyzer over all translation units of the
+// selected targets and their dependencies, and collects the results as HTML reports in
+// the Out directory. Each translation unit is analyzed in a separate build step.
+type StaticAnalyzerReport struct {
+	Out core.OutPath
+
+	// Additional flags passed to the analyzer, e.g. "-analyzer-checker=..." via -Xanalyzer.
+	Flags []string
+
+	targets []core.AnalyzeInterface
+}
+
+// Report for StaticAnalyzerReport.
+func (rep StaticAnalyzerReport) Report(allTargets []interface{}, selectedTargets []interface{}) core.BuildInterface {
+	rep.targets = analysisTargets(selectedTargets)
+	return rep
+}
+
+// Build a StaticAnalyzerReport.
+func (rep StaticAnalyzerReport) Build(ctx core.Context) {
+	if rep.Out == nil {
+		core.Fatal("Out field is required for cc.StaticAnalyzerReport")
+	}
+
+	stamps := []core.Path{}
+	for _, unit := range collectTranslationUnits(ctx, rep.targets) {
+		stamp := rep.Out.WithSuffix("/" + unit.Object.Relative() + ".analyzed")
+		unitDir := rep.Out.WithSuffix("/" + unit.Object.Relative())
+		// The object file is an input so that generated sources and headers of the
+		// translation unit exist before it is analyzed.
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   stamp,
+			Ins:   []core.Path{unit.Source, unit.Object},
+			Cmd:   fmt.Sprintf("%s --analyze --analyzer-output html %s %s -o %q %q && touch %q", clangAnalyzerFlag.Value(), ninjaEscapeDollars(strings.Join(unit.Flags, " ")), strings.Join(rep.Flags, " "), unitDir, unit.Source, stamp),
+			Descr: fmt.Sprintf("ANALYZE %s", unit.Source.Relative()),
+		})
+		stamps = append(stamps, stamp)
+	}
+
+	index := rep.Out.WithSuffix("/index.html")
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   index,
+		Ins:   stamps,
+		Cmd:   fmt.Sprintf("cd %q && { echo '<html><body><ul>'; find . -name 'report-*.html' | sort | sed 's|.*|<li><a href=\"&\">&</a></li>|'; echo '</ul></body></html>'; } > index.html", rep.Out),
+		Descr: fmt.Sprintf("ANALYZE REPORT %s", index.Relative()),
+	})
+}
+
+// IwyuReport runs include-what-you-use over all translation units of the selected targets
+// and their dependencies, and combines the suggestions into the text report Out. Each
+// translation unit is checked in a separate build step.
+type IwyuReport struct {
+	Out core.OutPath
+
+	// Additional flags passed to include-what-you-use, e.g. "-Xiwyu --mapping_file=...".
+	Flags []string
+
+	// FailOnViolations fails the build if include-what-you-use suggests any changes.
+	FailOnViolations bool
+
+	targets []core.AnalyzeInterface
+}
+
+// Report for IwyuReport.
+func (rep IwyuReport) Report(allTargets []interface{}, selectedTargets []interface{}) core.BuildInterface {
+	rep.targets = analysisTargets(selectedTargets)
+	return rep
+}
+
+// Build an IwyuReport.
+func (rep IwyuReport) Build(ctx core.Context) {
+	if rep.Out == nil {
+		core.Fatal("Out field is required for cc.IwyuReport")
+	}
+
+	// include-what-you-use exits with a non-zero status whenever it suggests changes, so
+	// violations are detected from its output instead.
+	check := ""
+	if rep.FailOnViolations {
+		check = fmt.Sprintf(" && awk '/should (add|remove) these lines:/{f=1;next} /^$/{f=0} f{v=1} END{exit v}' %q", rep.Out)
+	}
+
+	results := []core.Path{}
+	for _, unit := range collectTranslationUnits(ctx, rep.targets) {
+		result := rep.Out.WithSuffix(".d/" + unit.Object.Relative() + ".iwyu")
+		// The object file is an input so that generated sources and headers of the
+		// translation unit exist before it is checked.
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   result,
+			Ins:   []core.Path{unit.Source, unit.Object},
+			Cmd:   fmt.Sprintf("%s %s %s %q > %q 2>&1 || true", iwyuFlag.Value(), ninjaEscapeDollars(strings.Join(unit.Flags, " ")), strings.Join(rep.Flags, " "), unit.Source, result),
+			Descr: fmt.Sprintf("IWYU %s", unit.Source.Relative()),
+		})
+		results = append(results, result)
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   rep.Out,
+		Ins:   results,
+		Cmd:   fmt.Sprintf("cat /dev/null %s > %q%s", joinQuoted(results), rep.Out, check),
+		Descr: fmt.Sprintf("IWYU REPORT %s", rep.Out.Relative()),
+	})
+}
@@ -15,10 +15,59 @@ func init() {
 	core.AssertIsBuildableTarget(&Binary{})
 	core.AssertIsBuildableTarget(&BlobObject{})
 	core.AssertIsBuildableTarget(&objectFile{})
+	core.AssertIsBuildableTarget(&ObjectFile{})
 	core.AssertIsRunnableTarget(&Binary{})
 }
 
-// objectFile compiles a single C++ source file.
+var deterministicArchivesFlag = core.BoolFlag{
+	Name:        "cc-deterministic-ar",
+	Description: "Create static archives without timestamps, uids and gids to make them reproducible",
+	DefaultFn:   func() bool { return true },
+}.Register()
+
+var linkModeFlag = core.StringFlag{
+	Name:          "cc-link-mode",
+	Description:   "Link libraries that do not explicitly request to be shared either statically or as shared libraries, which are compiled with -fPIC and written with a .so extension instead of .a",
+	DefaultFn:     func() string { return "static" },
+	AllowedValues: []string{"static", "shared"},
+}.Register()
+
+var soNoUndefinedFlag = core.BoolFlag{
+	Name:        "cc-so-no-undefined",
+	Description: "Fail linking shared libraries with unresolved symbols, unless the library sets AllowUndefined",
+	DefaultFn:   func() bool { return false },
+}.Register()
+
+var optLevelFlag = core.StringFlag{
+	Name:          "cc-opt-level",
+	Description:   "Optimization level passed as -O<level> to the C and C++ compilers after the toolchain flags, or empty to keep the toolchain's",
+	DefaultFn:     func() string { return "" },
+	AllowedValues: []string{"", "0", "1", "2", "3", "s", "g", "fast"},
+}.Register()
+
+var debugFlag = core.BoolFlag{
+	Name:        "cc-debug",
+	Description: "Pass -g to the C and C++ compilers after the toolchain flags",
+	DefaultFn:   func() bool { return false },
+}.Register()
+
+// buildModeFlags returns the flags selected with the cc-opt-level and cc-debug flags,
+// which follow the toolchain flags to override them.
+func buildModeFlags() []string {
+	flags := []string{}
+	if optLevelFlag.Value() != "" {
+		flags = append(flags, "-O"+optLevelFlag.Value())
+	}
+	if debugFlag.Value() {
+		flags = append(flags, "-g")
+	}
+	return flags
+}
+
+// objectFile compiles a single C++ source file. Assembly sources that need the C
+// preprocessor (.S, .sx) are compiled with the C compiler driver, plain assembly
+// sources (.s) with the assembler. The AsFlags of the toolchain and of the object are
+// passed to either, after the CFlags of the toolchain for the C compiler driver.
 type objectFile struct {
 	Out       core.OutPath
 	Src       core.Path
@@ -29,12 +78,22 @@ type objectFile struct {
 	CxxFlags  []string
 	AsFlags   []string
 	Toolchain Toolchain
+
+	// Defines are the -D flags of the target, which C and C++ sources get with their
+	// flags, for assembly sources needing the C preprocessor.
+	Defines []string
 }
 
 func ninjaEscape(s string) string {
 	return strings.ReplaceAll(s, " ", "$ ")
 }
 
+// ninjaEscapeDollars escapes the $ in flags that are put into a build command, so that
+// ninja passes them on to the shell.
+func ninjaEscapeDollars(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
 func (obj objectFile) cxxRule(ctx core.Context) core.BuildRule {
 	toolchain := toolchainOrDefault(obj.Toolchain)
 	name := toolchain.Name() + "-cxx"
@@ -47,7 +106,8 @@ func (obj objectFile) cxxRule(ctx core.Context) core.BuildRule {
 		Name: name,
 		Variables: map[string]string{
 			"depfile":     "$out.d",
-			"command":     fmt.Sprintf("%s %s $flags -pipe -c -MD -MF $out.d -o $out $in", ninjaEscape(toolchain.CxxCompiler()), strings.Join(toolchain.CxxFlags(), " ")),
+			"deps":        "gcc",
+			"command":     fmt.Sprintf("%s %s $flags -pipe -c -MD -MF $out.d -o $out $in", toolCommand(toolchain, toolchain.CxxCompiler()), strings.Join(append(toolchain.CxxFlags(), buildModeFlags()...), " ")),
 			"description": fmt.Sprintf("CXX (toolchain: %s) $out", toolchain.Name()),
 		},
 	}
@@ -67,7 +127,8 @@ func (obj objectFile) ccRule(ctx core.Context) core.BuildRule {
 		Name: name,
 		Variables: map[string]string{
 			"depfile":     "$out.d",
-			"command":     fmt.Sprintf("%s %s $flags -pipe -c -MD -MF $out.d -o $out $in", ninjaEscape(toolchain.CCompiler()), strings.Join(toolchain.CFlags(), " ")),
+			"deps":        "gcc",
+			"command":     fmt.Sprintf("%s %s $flags -pipe -c -MD -MF $out.d -o $out $in", toolCommand(toolchain, toolchain.CCompiler()), strings.Join(append(toolchain.CFlags(), buildModeFlags()...), " ")),
 			"description": fmt.Sprintf("CC (toolchain: %s) $out", toolchain.Name()),
 		},
 	}
@@ -86,7 +147,30 @@ func (obj objectFile) asRule(ctx core.Context) core.BuildRule {
 	rule := core.BuildRule{
 		Name: name,
 		Variables: map[string]string{
-			"command":     fmt.Sprintf("%s %s $flags -c -o $out $in", ninjaEscape(toolchain.Assembler()), strings.Join(toolchain.AsFlags(), " ")),
+			"command":     fmt.Sprintf("%s %s $flags -c -o $out $in", toolCommand(toolchain, toolchain.Assembler()), strings.Join(toolchain.AsFlags(), " ")),
+			"description": fmt.Sprintf("AS (toolchain: %s) $out", toolchain.Name()),
+		},
+	}
+	ctx.RegisterCompDbRule(&rule)
+	return rule
+}
+
+// cppAsRule assembles sources that need the C preprocessor with the C compiler driver. The
+// toolchain's assembler flags follow its C flags, e.g. for -march or -mcpu options.
+func (obj objectFile) cppAsRule(ctx core.Context) core.BuildRule {
+	toolchain := toolchainOrDefault(obj.Toolchain)
+	name := toolchain.Name() + "-cpp-as"
+
+	if rule, ok := ctx.GetCompDbRule(name); ok {
+		return *rule
+	}
+
+	rule := core.BuildRule{
+		Name: name,
+		Variables: map[string]string{
+			"depfile":     "$out.d",
+			"deps":        "gcc",
+			"command":     fmt.Sprintf("%s %s -x assembler-with-cpp $flags -pipe -c -MD -MF $out.d -o $out $in", toolCommand(toolchain, toolchain.CCompiler()), strings.Join(append(toolchain.CFlags(), toolchain.AsFlags()...), " ")),
 			"description": fmt.Sprintf("AS (toolchain: %s) $out", toolchain.Name()),
 		},
 	}
@@ -94,14 +178,28 @@ func (obj objectFile) asRule(ctx core.Context) core.BuildRule {
 	return rule
 }
 
+// assertObjC fails if the toolchain of the object does not compile Objective-C sources.
+func (obj objectFile) assertObjC() {
+	toolchain := toolchainOrDefault(obj.Toolchain)
+	if !ToolchainObjC(toolchain) {
+		core.Fatal("toolchain '%s' does not support Objective-C source %s", toolchain.Name(), obj.Src.Relative())
+	}
+}
+
 func (obj objectFile) flags(tc Toolchain) []string {
 	flags := []string{}
 	switch filepath.Ext(obj.Src.Absolute()) {
-	case ".cc":
-		flags = append(tc.CxxFlags(), obj.CxxFlags...)
+	case ".cc", ".cpp", ".cxx", ".c++":
+		flags = append(append(tc.CxxFlags(), buildModeFlags()...), obj.CxxFlags...)
 	case ".c":
-		flags = append(tc.CFlags(), obj.CFlags...)
-	case ".S":
+		flags = append(append(tc.CFlags(), buildModeFlags()...), obj.CFlags...)
+	case ".m":
+		flags = append(append(append(tc.CFlags(), buildModeFlags()...), "-x", "objective-c"), obj.CFlags...)
+	case ".mm":
+		flags = append(append(append(tc.CxxFlags(), buildModeFlags()...), "-x", "objective-c++"), obj.CxxFlags...)
+	case ".S", ".sx":
+		flags = append(append(append(append(tc.CFlags(), tc.AsFlags()...), "-x", "assembler-with-cpp"), obj.Defines...), obj.AsFlags...)
+	case ".s":
 		flags = append(tc.AsFlags(), obj.AsFlags...)
 	default:
 		core.Fatal("Unknown source extension for cc toolchain '" + filepath.Ext(obj.Src.Absolute()) + "'")
@@ -121,29 +219,33 @@ func (obj objectFile) Build(ctx core.Context) {
 	flags := []string{}
 
 	switch filepath.Ext(obj.Src.Absolute()) {
-	case ".cc":
+	case ".cc", ".cpp", ".cxx", ".c++":
 		rule = obj.cxxRule(ctx)
 		flags = obj.CxxFlags
 	case ".c":
 		rule = obj.ccRule(ctx)
 		flags = obj.CFlags
-	case ".S":
+	case ".m":
+		obj.assertObjC()
+		rule = obj.ccRule(ctx)
+		flags = append([]string{"-x", "objective-c"}, obj.CFlags...)
+	case ".mm":
+		obj.assertObjC()
+		rule = obj.cxxRule(ctx)
+		flags = append([]string{"-x", "objective-c++"}, obj.CxxFlags...)
+	case ".S", ".sx":
+		rule = obj.cppAsRule(ctx)
+		flags = append(append([]string{}, obj.Defines...), obj.AsFlags...)
+	case ".s":
 		rule = obj.asRule(ctx)
 		flags = obj.AsFlags
 	default:
 		core.Fatal("Unknown source extension for cc toolchain '" + filepath.Ext(obj.Src.Absolute()) + "'")
 	}
 
-	includes := map[string]bool{}
-	for _, include := range obj.Includes {
-		includes[fmt.Sprintf("-I%q", include)] = true
+	for _, include := range uniquePaths(obj.Includes) {
+		flags = append(flags, fmt.Sprintf("-I%q", include))
 	}
-	includeFlags := []string{}
-	for include := range includes {
-		includeFlags = append(includeFlags, include)
-	}
-	sort.Strings(includeFlags)
-	flags = append(flags, includeFlags...)
 
 	ctx.WithTrace("obj:"+obj.Out.Relative(), func(ctx core.Context) {
 		ctx.AddBuildStepWithRule(core.BuildStepWithRule{
@@ -153,12 +255,52 @@ func (obj objectFile) Build(ctx core.Context) {
 			OrderDeps:    obj.OrderDeps,
 			Rule:         rule,
 			Variables: map[string]string{
-				"flags": strings.Join(flags, " "),
+				"flags": ninjaEscapeDollars(strings.Join(flags, " ")),
 			},
 		})
 	})
 }
 
+// ObjectFile compiles a single source file into an object file with a user-chosen name,
+// e.g. to place it in a custom linker section. The object can be passed to Library.Objs
+// or Binary.Objs. Deps only contribute their include directories and generated headers.
+type ObjectFile struct {
+	Out       core.OutPath
+	Src       core.Path
+	Includes  []core.Path
+	CFlags    []string
+	CxxFlags  []string
+	CxxStd    string
+	AsFlags   []string
+	Defines   map[string]string
+	Deps      []Dep
+	Toolchain Toolchain
+}
+
+// Build an ObjectFile.
+func (obj ObjectFile) Build(ctx core.Context) {
+	if obj.Out == nil {
+		core.Fatal("Out field is required for cc.ObjectFile")
+	}
+
+	toolchain := toolchainOrDefault(obj.Toolchain)
+	deps := collectDepsWithToolchain(toolchain, obj.Deps)
+	for _, d := range deps {
+		d.Build(ctx)
+	}
+
+	cFlags := append(defineFlags(obj.Defines), obj.CFlags...)
+	cxxFlags := withCxxStd(append(defineFlags(obj.Defines), obj.CxxFlags...), obj.CxxStd)
+
+	object := getObjs(obj.Out, ctx, []core.Path{obj.Src}, cFlags, cxxFlags, obj.AsFlags, defineFlags(obj.Defines), deps, obj.Includes, toolchain, []core.Path{}, map[core.Path][]core.Path{})[0]
+	object.Out = obj.Out
+	object.Build(ctx)
+}
+
+func (obj ObjectFile) Output() core.OutPath {
+	return obj.Out
+}
+
 // BlobObject creates a relocatable object file from any blob of data.
 type BlobObject struct {
 	In        core.Path
@@ -172,7 +314,7 @@ func (blob BlobObject) Build(ctx core.Context) {
 		ctx.AddBuildStep(core.BuildStep{
 			Out:   blob.out(),
 			In:    blob.In,
-			Cmd:   fmt.Sprintf("%s %s -r -b binary -o %q %q", blob.Toolchain.Link(), strings.Join(blob.Toolchain.LdFlags(), " "), blob.out(), blob.In),
+			Cmd:   fmt.Sprintf("%s %s -r -b binary -o %q %q", toolCommand(toolchain, toolchain.Link()), strings.Join(toolchain.LdFlags(), " "), blob.out(), blob.In),
 			Descr: fmt.Sprintf("BLOB (toolchain: %s) %s", toolchain.Name(), blob.out().Relative()),
 		})
 	})
@@ -186,7 +328,12 @@ func (blob BlobObject) out() core.OutPath {
 func collectDepsWithToolchainRec(toolchain Toolchain, dep Dep, visited map[string]int, stack *[]Library) {
 	lib := dep.CcLibrary(toolchain)
 
-	libPath := lib.Out.Absolute()
+	libPath := ""
+	if lib.pkgConfig != "" {
+		libPath = "pkg-config:" + lib.pkgConfig
+	} else {
+		libPath = lib.Out.Absolute()
+	}
 
 	if visited[libPath] == 2 {
 		return
@@ -261,14 +408,75 @@ func includesForSoruces(srcs []core.Path, private bool) []core.Path {
 	return result
 }
 
-func getObjs(out core.OutPath, ctx core.Context, srcs []core.Path, cFlags []string, cxxFlags []string, asFlags []string, deps []Library, includes []core.Path, toolchain Toolchain, orderDeps []core.Path, compileDeps map[core.Path][]core.Path) []objectFile {
+var validCxxStds = map[string]bool{
+	"c++98": true, "c++03": true, "c++11": true, "c++14": true, "c++17": true, "c++20": true, "c++23": true,
+	"gnu++98": true, "gnu++03": true, "gnu++11": true, "gnu++14": true, "gnu++17": true, "gnu++20": true, "gnu++23": true,
+}
+
+// withCxxStd appends the flag selecting the given C++ language standard, if any, to the
+// C++ flags. The flag comes last so that it overrides the toolchain's default standard.
+func withCxxStd(cxxFlags []string, std string) []string {
+	if std == "" {
+		return cxxFlags
+	}
+	if !validCxxStds[std] {
+		core.Fatal("Invalid C++ standard '%s'", std)
+	}
+	return append(append([]string{}, cxxFlags...), "-std="+std)
+}
+
+// defineFlags renders preprocessor definitions as -D flags, sorted by name. Definitions
+// with an empty value are rendered without a value. Values are quoted for the shell, so
+// that they may contain spaces or quotes, and must be escaped with ninjaEscapeDollars
+// where they are put into a build command. The flags come before the target's own flags,
+// so that those can still override them.
+func defineFlags(defines map[string]string) []string {
+	names := []string{}
+	for name := range defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := []string{}
+	for _, name := range names {
+		if defines[name] == "" {
+			flags = append(flags, "-D"+name)
+		} else {
+			flag := fmt.Sprintf("-D%s=%s", name, defines[name])
+			flags = append(flags, "'"+strings.ReplaceAll(flag, "'", `'\''`)+"'")
+		}
+	}
+	return flags
+}
+
+// uniquePaths removes duplicate paths, keeping the first occurrence of each path so
+// that the relative order of the remaining paths is preserved.
+func uniquePaths(paths []core.Path) []core.Path {
+	seen := map[string]bool{}
+	result := []core.Path{}
+	for _, p := range paths {
+		if seen[p.Absolute()] {
+			continue
+		}
+		seen[p.Absolute()] = true
+		result = append(result, p)
+	}
+	return result
+}
+
+func getObjs(out core.OutPath, ctx core.Context, srcs []core.Path, cFlags []string, cxxFlags []string, asFlags []string, defines []string, deps []Library, includes []core.Path, toolchain Toolchain, orderDeps []core.Path, compileDeps map[core.Path][]core.Path) []objectFile {
 	for _, dep := range deps {
 		includes = append(includes, dep.Includes...)
-		orderDeps = append(orderDeps, dep.GeneratedSrcs...)
+		orderDeps = append(orderDeps, dep.generatedFiles()...)
+		if len(dep.pkgCFlags) > 0 {
+			cFlags = append(append([]string{}, dep.pkgCFlags...), cFlags...)
+			cxxFlags = append(append([]string{}, dep.pkgCFlags...), cxxFlags...)
+		}
 	}
 
 	includes = append(includes, includesForSoruces(srcs, true)...)
 	includes = append(includes, core.SourcePath(""))
+	includes = uniquePaths(includes)
 
 	objs := []objectFile{}
 
@@ -283,15 +491,16 @@ func getObjs(out core.OutPath, ctx core.Context, srcs []core.Path, cFlags []stri
 			CxxFlags:  cxxFlags,
 			AsFlags:   asFlags,
 			Toolchain: toolchain,
+			Defines:   defines,
 		})
 	}
 
 	return objs
 }
 
-func compileSources(out core.OutPath, ctx core.Context, srcs []core.Path, cFlags []string, cxxFlags []string, asFlags []string, deps []Library, includes []core.Path, toolchain Toolchain, orderDeps []core.Path, compileDeps map[core.Path][]core.Path) []core.Path {
+func compileSources(out core.OutPath, ctx core.Context, srcs []core.Path, cFlags []string, cxxFlags []string, asFlags []string, defines []string, deps []Library, includes []core.Path, toolchain Toolchain, orderDeps []core.Path, compileDeps map[core.Path][]core.Path) []core.Path {
 	objs := []core.Path{}
-	for _, obj := range getObjs(out, ctx, srcs, cFlags, cxxFlags, asFlags, deps, includes, toolchain, orderDeps, compileDeps) {
+	for _, obj := range getObjs(out, ctx, srcs, cFlags, cxxFlags, asFlags, defines, deps, includes, toolchain, orderDeps, compileDeps) {
 		obj.Build(ctx)
 		objs = append(objs, obj.Out)
 	}
@@ -314,30 +523,102 @@ type Library struct {
 	Out           core.OutPath
 	Srcs          []core.Path
 	GeneratedSrcs []core.Path
+	GeneratedHdrs []core.Path
 	Blobs         []core.Path
 	CompileDeps   map[core.Path][]core.Path
 	Objs          []core.Path
 	Includes      []core.Path
 	CFlags        []string
 	CxxFlags      []string
+	CxxStd        string
 	AsFlags       []string
+	Defines       map[string]string
 	Deps          []Dep
 	Shared        bool
 	AlwaysLink    bool
 	Toolchain     Toolchain
 
+	// ExportMap controls the symbols exported by a shared library: a version script for
+	// GNU-style linkers, or a .def file for lld-link.
+	ExportMap core.Path
+
+	// Prelink merges all objects of the library into a single relocatable object (a
+	// partial link) instead of archiving them. The object is written to Out.
+	Prelink bool
+
+	// LocalizeSymbols are made local to the library and KeepGlobalSymbols are the only
+	// global symbols kept in it, to avoid symbol clashes between libraries. Both are
+	// applied to the library's objects with objcopy before they are linked.
+	LocalizeSymbols   []string
+	KeepGlobalSymbols []string
+
+	// AllowUndefined permits unresolved symbols in a shared library that relies on
+	// them being resolved at load time, even if cc-so-no-undefined is set.
+	AllowUndefined bool
+
+	// HiddenVisibility compiles the library's sources with hidden symbol visibility,
+	// so that only symbols marked with __attribute__((visibility("default"))) are
+	// exported. It does not apply to dependents.
+	HiddenVisibility bool
+
+	// prebuilt is copied to Out instead of building the library (see PrebuiltLibrary).
+	prebuilt core.Path
+
+	// pkgConfig is the module of a library created by PkgConfig. Such a library has no Out
+	// and only adds pkgCFlags to the compile flags and pkgLibs to the link of dependents.
+	pkgConfig string
+	pkgCFlags []string
+	pkgLibs   []string
+
 	// Extra fields for handling multi-toolchain logic.
 	userOut       core.OutPath
 	userToolchain Toolchain
 }
 
+// cFlags returns the flags for compiling the library's C sources.
+func (lib Library) cFlags() []string {
+	flags := append(defineFlags(lib.Defines), lib.picFlags()...)
+	if lib.HiddenVisibility {
+		flags = append(flags, "-fvisibility=hidden")
+	}
+	return append(flags, lib.CFlags...)
+}
+
+// cxxFlags returns the flags for compiling the library's C++ sources.
+func (lib Library) cxxFlags() []string {
+	flags := append(defineFlags(lib.Defines), lib.picFlags()...)
+	if lib.HiddenVisibility {
+		flags = append(flags, "-fvisibility=hidden", "-fvisibility-inlines-hidden")
+	}
+	return withCxxStd(append(flags, lib.CxxFlags...), lib.CxxStd)
+}
+
+// picFlags returns the flags for compiling the sources of a shared library as position
+// independent code.
+func (lib Library) picFlags() []string {
+	if !lib.isShared() {
+		return []string{}
+	}
+	switch toolchainOrDefault(lib.Toolchain).LinkerFlavor() {
+	case Ld, LdLld, Gcc, Clang:
+		return []string{"-fPIC"}
+	}
+	return []string{}
+}
+
+// generatedFiles returns the generated sources and headers of the library. They must
+// exist before any of the library's or its dependents' sources can be compiled.
+func (lib Library) generatedFiles() []core.Path {
+	return append(append([]core.Path{}, lib.GeneratedSrcs...), lib.GeneratedHdrs...)
+}
+
 func (lib Library) TranslationUnits(ctx core.Context) []core.TranslationUnit {
 	result := []core.TranslationUnit{}
 
 	toolchain := toolchainOrDefault(lib.Toolchain)
 	deps := collectDepsWithToolchain(toolchain, append(lib.Deps, toolchain.StdDeps()...))
 
-	objs := getObjs(lib.Out, ctx, append(lib.Srcs, lib.GeneratedSrcs...), lib.CFlags, lib.CxxFlags, lib.AsFlags, deps, lib.Includes, toolchain, lib.GeneratedSrcs, map[core.Path][]core.Path{})
+	objs := getObjs(lib.Out, ctx, append(lib.Srcs, lib.GeneratedSrcs...), lib.cFlags(), lib.cxxFlags(), lib.AsFlags, defineFlags(lib.Defines), deps, lib.Includes, toolchain, lib.generatedFiles(), map[core.Path][]core.Path{})
 
 	for _, obj := range objs {
 		result = append(result, core.TranslationUnit{
@@ -369,12 +650,19 @@ func (lib Library) arRule() core.BuildRule {
 	// There is no option to ar to always force creation of a new archive; the "c"
 	// modifier simply suppresses a warning if the archive doesn't already
 	// exist. So instead we delete the target (out) if it already exists.
+	// The "D" modifier zeroes timestamps, uids and gids of the archive members, so that
+	// archiving the same objects twice produces bit-for-bit identical archives. Archives
+	// created by lld-link's /lib mode do not carry such metadata in the first place.
+	arFlags := "rcsT"
+	if deterministicArchivesFlag.Value() {
+		arFlags = "rcsDT"
+	}
 	switch toolchain.LinkerFlavor() {
 	case LldLink:
 		return core.BuildRule{
 			Name: toolchain.Name() + "-lib",
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("rm -f $out 2> /dev/null; %s /out:$out $in", ninjaEscape(toolchain.Archiver())),
+				"command":     fmt.Sprintf("rm -f $out 2> /dev/null; %s /out:$out $in", toolCommand(toolchain, toolchain.Archiver())),
 				"description": fmt.Sprintf("AR (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
@@ -382,7 +670,7 @@ func (lib Library) arRule() core.BuildRule {
 		return core.BuildRule{
 			Name: toolchain.Name() + "-ar",
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("rm -f $out 2> /dev/null; %s rcsT $out $in", ninjaEscape(toolchain.Archiver())),
+				"command":     fmt.Sprintf("rm -f $out 2> /dev/null; %s %s $out $in", toolCommand(toolchain, toolchain.Archiver()), arFlags),
 				"description": fmt.Sprintf("AR (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
@@ -399,7 +687,7 @@ func (lib Library) soRule() core.BuildRule {
 		return core.BuildRule{
 			Name: toolchain.Name() + "-dll",
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("%s -shared %s /out:$out $in", ninjaEscape(toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
+				"command":     fmt.Sprintf("%s -shared %s $flags /out:$out /IMPLIB:$implib $in", toolCommand(toolchain, toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
 				"description": fmt.Sprintf("LD (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
@@ -407,7 +695,7 @@ func (lib Library) soRule() core.BuildRule {
 		return core.BuildRule{
 			Name: toolchain.Name() + "-so",
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("%s -shared %s -o $out $in", ninjaEscape(toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
+				"command":     fmt.Sprintf("%s -shared %s $flags -o $out $in", toolCommand(toolchain, toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
 				"description": fmt.Sprintf("LD (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
@@ -417,17 +705,52 @@ func (lib Library) soRule() core.BuildRule {
 	return core.BuildRule{}
 }
 
+func (lib Library) prelinkRule() core.BuildRule {
+	toolchain := toolchainOrDefault(lib.Toolchain)
+	switch toolchain.LinkerFlavor() {
+	case Ld, LdLld:
+		return core.BuildRule{
+			Name: toolchain.Name() + "-prelink",
+			Variables: map[string]string{
+				"command":     fmt.Sprintf("%s -r -o $out $in", toolCommand(toolchain, toolchain.Link())),
+				"description": fmt.Sprintf("PRELINK (toolchain: %s) $out", toolchain.Name()),
+			},
+		}
+	case Gcc, Clang:
+		return core.BuildRule{
+			Name: toolchain.Name() + "-prelink",
+			Variables: map[string]string{
+				"command":     fmt.Sprintf("%s -nostdlib -r -o $out $in", toolCommand(toolchain, toolchain.Link())),
+				"description": fmt.Sprintf("PRELINK (toolchain: %s) $out", toolchain.Name()),
+			},
+		}
+	default:
+		core.Fatal("Prelinking is not supported by toolchain '%s'", toolchain.Name())
+	}
+	return core.BuildRule{}
+}
+
 // Build a Library.
 func (lib Library) build(ctx core.Context) {
 	if lib.Out == nil {
 		core.Fatal("Out field is required for cc.Library")
 	}
 
+	if lib.prebuilt != nil {
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   lib.Out,
+			In:    lib.prebuilt,
+			Cmd:   fmt.Sprintf("cp %q %q", lib.prebuilt, lib.Out),
+			Descr: fmt.Sprintf("CP %s", lib.Out.Relative()),
+		})
+		return
+	}
+
 	toolchain := toolchainOrDefault(lib.Toolchain)
 
 	deps := collectDepsWithToolchain(toolchain, append(lib.Deps, toolchain.StdDeps()...))
 
-	objs := compileSources(lib.Out, ctx, append(lib.Srcs, lib.GeneratedSrcs...), lib.CFlags, lib.CxxFlags, lib.AsFlags, deps, lib.Includes, toolchain, lib.GeneratedSrcs, lib.CompileDeps)
+	objs := compileSources(lib.Out, ctx, append(lib.Srcs, lib.GeneratedSrcs...), lib.cFlags(), lib.cxxFlags(), lib.AsFlags, defineFlags(lib.Defines), deps, lib.Includes, toolchain, lib.generatedFiles(), lib.CompileDeps)
 	objs = append(objs, lib.Objs...)
 
 	for _, blob := range lib.Blobs {
@@ -436,24 +759,162 @@ func (lib Library) build(ctx core.Context) {
 		objs = append(objs, blobObject.out())
 	}
 
+	objs = lib.localizeSymbols(ctx, objs)
+
 	rule := core.BuildRule{}
+	outs := []core.OutPath{lib.out()}
+	variables := map[string]string{}
+	implicitDeps := []core.Path{}
 
-	if lib.Shared {
+	if lib.Prelink {
+		if lib.Shared {
+			core.Fatal("cc.Library cannot be both Shared and Prelink")
+		}
+		rule = lib.prelinkRule()
+	} else if lib.isShared() {
 		rule = lib.soRule()
+		variables["flags"] = strings.Join(lib.soFlags(), " ")
+		if lib.ExportMap != nil {
+			implicitDeps = append(implicitDeps, lib.ExportMap)
+		}
+		if importLib := lib.importLib(); importLib != nil {
+			outs = append(outs, importLib)
+			variables["implib"] = fmt.Sprintf("%q", importLib)
+		}
 	} else {
 		rule = lib.arRule()
 	}
 	ctx.AddBuildStepWithRule(core.BuildStepWithRule{
-		Outs: []core.OutPath{lib.Out},
-		Ins:  objs,
-		Rule: rule,
+		Outs:         outs,
+		Ins:          objs,
+		ImplicitDeps: implicitDeps,
+		Rule:         rule,
+		Variables:    variables,
 	})
 }
 
+// localizeSymbols runs objcopy over the given objects to apply LocalizeSymbols and
+// KeepGlobalSymbols, and returns the resulting objects.
+func (lib Library) localizeSymbols(ctx core.Context, objs []core.Path) []core.Path {
+	if len(lib.LocalizeSymbols) == 0 && len(lib.KeepGlobalSymbols) == 0 {
+		return objs
+	}
+
+	toolchain := toolchainOrDefault(lib.Toolchain)
+
+	args := []string{}
+	for _, symbol := range lib.LocalizeSymbols {
+		args = append(args, fmt.Sprintf("--localize-symbol=%q", symbol))
+	}
+	for _, symbol := range lib.KeepGlobalSymbols {
+		args = append(args, fmt.Sprintf("--keep-global-symbol=%q", symbol))
+	}
+
+	result := []core.Path{}
+	for _, obj := range objs {
+		out := obj.WithExt("localized.o")
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   out,
+			In:    obj,
+			Cmd:   fmt.Sprintf("%s %s %q %q", toolCommand(toolchain, toolchain.ObjcopyCommand()), strings.Join(args, " "), obj, out),
+			Descr: fmt.Sprintf("OBJCOPY (toolchain: %s) %s", toolchain.Name(), out.Relative()),
+		})
+		result = append(result, out)
+	}
+	return result
+}
+
+// importLib returns the import library that is created alongside a DLL by lld-link, or
+// nil if the library does not have one.
+func (lib Library) importLib() core.OutPath {
+	if !lib.isShared() || toolchainOrDefault(lib.Toolchain).LinkerFlavor() != LldLink {
+		return nil
+	}
+	return lib.Out.WithExt("lib")
+}
+
+// linkOutput returns the file dependents link against: the import library for DLLs,
+// the library itself otherwise.
+func (lib Library) linkOutput() core.OutPath {
+	if importLib := lib.importLib(); importLib != nil {
+		return importLib
+	}
+	return lib.out()
+}
+
+// soFlags returns the library-specific flags for linking a shared library.
+func (lib Library) soFlags() []string {
+	toolchain := toolchainOrDefault(lib.Toolchain)
+	flags := []string{}
+
+	if lib.ExportMap != nil {
+		switch toolchain.LinkerFlavor() {
+		case LldLink:
+			flags = append(flags, fmt.Sprintf("/DEF:%q", lib.ExportMap))
+		case Ld, LdLld:
+			flags = append(flags, fmt.Sprintf("--version-script=%q", lib.ExportMap))
+		case Gcc, Clang:
+			flags = append(flags, fmt.Sprintf("-Wl,--version-script=%q", lib.ExportMap))
+		}
+	}
+
+	if soNoUndefinedFlag.Value() && !lib.AllowUndefined {
+		switch toolchain.LinkerFlavor() {
+		case Ld, LdLld:
+			flags = append(flags, "--no-undefined")
+		case Gcc, Clang:
+			flags = append(flags, "-Wl,--no-undefined")
+		}
+	}
+
+	return flags
+}
+
+// isShared reports whether the library is linked as a shared library, either because it
+// requests so explicitly or because the cc-link-mode flag selects shared linking.
+// AlwaysLink libraries are always archived, since whole-archive linking only applies to
+// static archives, prelinked libraries always produce a relocatable object, and prebuilt
+// libraries are used as they are.
+func (lib Library) isShared() bool {
+	if lib.Shared {
+		return true
+	}
+	return !lib.AlwaysLink && !lib.Prelink && lib.prebuilt == nil && linkModeFlag.Value() == "shared"
+}
+
+// out returns the file the library is written to. Libraries that are only shared because
+// of the cc-link-mode flag get a .so extension instead of the .a extension of their Out.
+func (lib Library) out() core.OutPath {
+	if !lib.Shared && lib.isShared() && strings.HasSuffix(lib.Out.Relative(), ".a") {
+		return lib.Out.WithExt("so")
+	}
+	return lib.Out
+}
+
 func (lib Library) Build(ctx core.Context) {
+	if lib.pkgConfig != "" {
+		return
+	}
 	ctx.WithTrace("lib:"+lib.Out.Relative(), lib.build)
 }
 
+// Output returns the file dependents link against.
+func (lib Library) Output() core.OutPath {
+	return lib.linkOutput()
+}
+
+// Outputs returns the library and its import library, if any, without the intermediate
+// objects.
+func (lib Library) Outputs() []core.Path {
+	if lib.pkgConfig != "" {
+		return []core.Path{}
+	}
+	if importLib := lib.importLib(); importLib != nil {
+		return []core.Path{lib.out(), importLib}
+	}
+	return []core.Path{lib.out()}
+}
+
 // CcLibrary for Library returns the library itself, or a toolchain-specific variant
 func (inputLibrary Library) CcLibrary(toolchain Toolchain) Library {
 	lib := inputLibrary
@@ -497,7 +958,9 @@ type Binary struct {
 	Srcs            []core.Path
 	CFlags          []string
 	CxxFlags        []string
+	CxxStd          string
 	AsFlags         []string
+	Defines         map[string]string
 	LinkerFlags     []string
 	LinkerFlagsPost []string
 	Deps            []Dep
@@ -507,6 +970,78 @@ type Binary struct {
 	Toolchain       Toolchain
 	Includes        []core.Path
 	Objs            []core.Path
+
+	// NoDefaultScript links the binary without the toolchain's linker script, e.g. for
+	// freestanding binaries that define their sections via LinkerFlags. The script is
+	// removed from the toolchain's linker flags (-T, --script and their -Wl, forms) and
+	// is no longer a dependency of the link.
+	NoDefaultScript bool
+
+	// SplitDebug links the binary with a build-id and moves its debug information into a
+	// separate .debug file next to it, which the stripped binary refers to with a
+	// .gnu_debuglink section, e.g. for symbolicating crashes of deployed binaries.
+	SplitDebug bool
+
+	// Strip removes all symbols and debug information from the binary after linking, e.g.
+	// for deployment. With SplitDebug, the debug information is still kept in the .debug
+	// file.
+	Strip bool
+
+	// GcSections compiles the binary's sources with one section per function and data
+	// object and lets the linker discard unreferenced sections. Libraries are compiled with
+	// their own flags, so they must add -ffunction-sections -fdata-sections themselves to
+	// benefit. AlwaysLink libraries are linked whole, but their unreferenced sections are
+	// still discarded, so sections only reached through the linker script must be kept
+	// there with KEEP.
+	GcSections bool
+
+	// LinkGroup links the libraries that are not AlwaysLink as a group, which the linker
+	// searches repeatedly to resolve circular references between static libraries.
+	LinkGroup bool
+
+	// Pie compiles the binary's sources with -fPIE and links it as a position-independent
+	// executable. NoPie links it with -no-pie instead, for toolchains producing PIEs by
+	// default. Both are ignored by freestanding toolchains. Static libraries linked into a
+	// PIE must be compiled with -fPIC or -fPIE themselves.
+	Pie   bool
+	NoPie bool
+}
+
+// gcSectionsFlags returns the compile flags needed for GcSections.
+func (bin Binary) gcSectionsFlags() []string {
+	if !bin.GcSections {
+		return []string{}
+	}
+	return []string{"-ffunction-sections", "-fdata-sections"}
+}
+
+// pieFlags returns the compile flags needed for Pie.
+func (bin Binary) pieFlags() []string {
+	if !bin.Pie || ToolchainFreestanding(toolchainOrDefault(bin.Toolchain)) {
+		return []string{}
+	}
+	return []string{"-fPIE"}
+}
+
+// unstripped returns the linked binary before it is stripped or its debug information is
+// split off.
+func (bin Binary) unstripped() core.OutPath {
+	return bin.Out.WithSuffix(".unstripped")
+}
+
+// DebugFile returns the file holding the debug information of a binary with SplitDebug.
+func (bin Binary) DebugFile() core.OutPath {
+	return bin.Out.WithSuffix(".debug")
+}
+
+// cFlags returns the flags for compiling the binary's C sources.
+func (bin Binary) cFlags() []string {
+	return append(append(append(defineFlags(bin.Defines), bin.gcSectionsFlags()...), bin.pieFlags()...), bin.CFlags...)
+}
+
+// cxxFlags returns the flags for compiling the binary's C++ sources.
+func (bin Binary) cxxFlags() []string {
+	return withCxxStd(append(append(append(defineFlags(bin.Defines), bin.gcSectionsFlags()...), bin.pieFlags()...), bin.CxxFlags...), bin.CxxStd)
 }
 
 func (bin Binary) TranslationUnits(ctx core.Context) []core.TranslationUnit {
@@ -515,7 +1050,7 @@ func (bin Binary) TranslationUnits(ctx core.Context) []core.TranslationUnit {
 	toolchain := toolchainOrDefault(bin.Toolchain)
 	deps := collectDepsWithToolchain(toolchain, append(bin.Deps, toolchain.StdDeps()...))
 
-	objs := getObjs(bin.Out, ctx, bin.Srcs, bin.CFlags, bin.CxxFlags, bin.AsFlags, deps, bin.Includes, toolchain, []core.Path{}, map[core.Path][]core.Path{})
+	objs := getObjs(bin.Out, ctx, bin.Srcs, bin.cFlags(), bin.cxxFlags(), bin.AsFlags, defineFlags(bin.Defines), deps, bin.Includes, toolchain, []core.Path{}, map[core.Path][]core.Path{})
 
 	for _, obj := range objs {
 		result = append(result, core.TranslationUnit{
@@ -552,23 +1087,63 @@ func (bin Binary) Build(ctx core.Context) {
 	ctx.WithTrace("bin:"+bin.Out.Relative(), bin.build)
 }
 
+// ldFlags returns the toolchain's linker flags, without the toolchain's linker script if
+// NoDefaultScript is set.
+func (bin Binary) ldFlags() []string {
+	toolchain := toolchainOrDefault(bin.Toolchain)
+	flags := toolchain.LdFlags()
+	script := toolchain.Script()
+	if !bin.NoDefaultScript || script == nil {
+		return flags
+	}
+
+	isScript := func(arg string) bool {
+		return arg == script.String() || arg == fmt.Sprintf("%q", script)
+	}
+	result := []string{}
+	for i := 0; i < len(flags); i++ {
+		if (flags[i] == "-T" || flags[i] == "--script") && i+1 < len(flags) && isScript(flags[i+1]) {
+			i++
+			continue
+		}
+		removed := false
+		for _, prefix := range []string{"-T", "--script=", "-Wl,-T,", "-Wl,--script="} {
+			if strings.HasPrefix(flags[i], prefix) && isScript(strings.TrimPrefix(flags[i], prefix)) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			result = append(result, flags[i])
+		}
+	}
+	return result
+}
+
 func (bin Binary) ldRule() core.BuildRule {
 	toolchain := toolchainOrDefault(bin.Toolchain)
 
+	// Binaries without the toolchain's linker script need a rule of their own, since the
+	// toolchain's linker flags are part of the rule.
+	suffix := ""
+	if bin.NoDefaultScript && toolchain.Script() != nil {
+		suffix = "-noscript"
+	}
+
 	switch toolchain.LinkerFlavor() {
 	case LldLink:
 		return core.BuildRule{
-			Name: toolchain.Name() + "-link",
+			Name: toolchain.Name() + "-link" + suffix,
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("%s %s $flags /out:$out $objs $libs $postFlags", ninjaEscape(toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
+				"command":     fmt.Sprintf("%s %s $flags /out:$out $objs $libs $postFlags", toolCommand(toolchain, toolchain.Link()), strings.Join(bin.ldFlags(), " ")),
 				"description": fmt.Sprintf("LD (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
 	case Ld, LdLld, Gcc, Clang:
 		return core.BuildRule{
-			Name: toolchain.Name() + "-ld",
+			Name: toolchain.Name() + "-ld" + suffix,
 			Variables: map[string]string{
-				"command":     fmt.Sprintf("%s %s $flags -o $out $objs $libs $postFlags", ninjaEscape(toolchain.Link()), strings.Join(toolchain.LdFlags(), " ")),
+				"command":     fmt.Sprintf("%s %s $flags -o $out $objs $libs $postFlags", toolCommand(toolchain, toolchain.Link()), strings.Join(bin.ldFlags(), " ")),
 				"description": fmt.Sprintf("LD (toolchain: %s) $out", toolchain.Name()),
 			},
 		}
@@ -585,7 +1160,7 @@ func (bin Binary) build(ctx core.Context) {
 	for _, d := range deps {
 		d.Build(ctx)
 	}
-	objs := compileSources(bin.Out, ctx, bin.Srcs, bin.CFlags, bin.CxxFlags, bin.AsFlags, deps, bin.Includes, toolchain, []core.Path{}, map[core.Path][]core.Path{})
+	objs := compileSources(bin.Out, ctx, bin.Srcs, bin.cFlags(), bin.cxxFlags(), bin.AsFlags, defineFlags(bin.Defines), deps, bin.Includes, toolchain, []core.Path{}, map[core.Path][]core.Path{})
 
 	objs = append(objs, bin.Objs...)
 
@@ -599,28 +1174,38 @@ func (bin Binary) build(ctx core.Context) {
 
 	libsPre := []Library{}
 	for _, dep := range bin.DepsPre {
-		lib := dep.CcLibrary(toolchain)
-		ins = append(ins, lib.Out)
-		libsPre = append(libsPre, lib)
+		libsPre = append(libsPre, dep.CcLibrary(toolchain))
 	}
 
 	deps = append(libsPre, deps...)
 
 	for _, dep := range bin.DepsPost {
-		lib := dep.CcLibrary(toolchain)
-		ins = append(ins, lib.Out)
-		deps = append(deps, lib)
+		deps = append(deps, dep.CcLibrary(toolchain))
 	}
+	deps = uniqueLinkLibraries(deps)
 
 	libsToLink := []string{}
 	libsToAlwaysLink := []string{}
+	rpaths := []string{}
+	seenRpaths := map[string]bool{}
 
 	for _, dep := range deps {
-		ins = append(ins, dep.Out)
+		if dep.pkgConfig != "" {
+			libsToLink = append(libsToLink, dep.pkgLibs...)
+			continue
+		}
+		ins = append(ins, dep.linkOutput())
+		if dep.isShared() {
+			rpath := path.Dir(dep.Out.Absolute())
+			if !seenRpaths[rpath] {
+				seenRpaths[rpath] = true
+				rpaths = append(rpaths, rpath)
+			}
+		}
 		if dep.AlwaysLink {
-			libsToAlwaysLink = append(libsToAlwaysLink, fmt.Sprintf("%q", dep.Out))
+			libsToAlwaysLink = append(libsToAlwaysLink, fmt.Sprintf("%q", dep.linkOutput()))
 		} else {
-			libsToLink = append(libsToLink, fmt.Sprintf("%q", dep.Out))
+			libsToLink = append(libsToLink, fmt.Sprintf("%q", dep.linkOutput()))
 		}
 	}
 
@@ -629,10 +1214,16 @@ func (bin Binary) build(ctx core.Context) {
 		libsToLink = append(libsToLink, "-wholearchive")
 		libsToLink = append(libsToLink, libsToAlwaysLink...)
 	case Ld, LdLld:
+		if bin.LinkGroup {
+			libsToLink = append(append([]string{"--start-group"}, libsToLink...), "--end-group")
+		}
 		libsToAlwaysLink = append([]string{"-whole-archive"}, libsToAlwaysLink...)
 		libsToAlwaysLink = append(libsToAlwaysLink, "-no-whole-archive")
 		libsToLink = append(libsToAlwaysLink, libsToLink...)
 	case Gcc, Clang:
+		if bin.LinkGroup {
+			libsToLink = append(append([]string{"-Wl,--start-group"}, libsToLink...), "-Wl,--end-group")
+		}
 		libsToAlwaysLink = append([]string{"-Wl,-whole-archive"}, libsToAlwaysLink...)
 		libsToAlwaysLink = append(libsToAlwaysLink, "-Wl,-no-whole-archive")
 		libsToLink = append(libsToAlwaysLink, libsToLink...)
@@ -642,17 +1233,78 @@ func (bin Binary) build(ctx core.Context) {
 
 	if bin.Script != nil {
 		ins = append(ins, bin.Script)
-	} else if toolchain.Script() != nil {
+	} else if toolchain.Script() != nil && !bin.NoDefaultScript {
 		ins = append(ins, toolchain.Script())
 	}
 
-	flags := bin.LinkerFlags
+	// The link rule passes the toolchain's flags first, then these flags starting with
+	// LinkerFlags in their given order, e.g. for --as-needed to apply to what follows.
+	flags := append([]string{}, bin.LinkerFlags...)
+	for _, rpath := range rpaths {
+		switch toolchain.LinkerFlavor() {
+		case Ld, LdLld:
+			flags = append(flags, "-rpath", fmt.Sprintf("%q", rpath))
+		case Gcc, Clang:
+			flags = append(flags, fmt.Sprintf("-Wl,-rpath,%q", rpath))
+		}
+	}
 	if bin.Script != nil {
 		flags = append(flags, "-T", fmt.Sprintf("%q", bin.Script))
 	}
 
+	if bin.GcSections {
+		switch toolchain.LinkerFlavor() {
+		case LldLink:
+			flags = append(flags, "/OPT:REF")
+		case Ld, LdLld:
+			flags = append(flags, "--gc-sections")
+		case Gcc, Clang:
+			flags = append(flags, "-Wl,--gc-sections")
+		}
+	}
+
+	if bin.Pie && bin.NoPie {
+		core.Fatal("binary %s sets both Pie and NoPie", bin.Out.Relative())
+	}
+	if (bin.Pie || bin.NoPie) && !ToolchainFreestanding(toolchain) {
+		switch toolchain.LinkerFlavor() {
+		case Ld, LdLld:
+			if bin.Pie {
+				flags = append(flags, "-pie")
+			} else {
+				flags = append(flags, "--no-pie")
+			}
+		case Gcc, Clang:
+			if bin.Pie {
+				flags = append(flags, "-pie")
+			} else {
+				flags = append(flags, "-no-pie")
+			}
+		default:
+			core.Fatal("Pie and NoPie are not supported by toolchain '%s'", toolchain.Name())
+		}
+	}
+
+	linkOut := bin.Out
+	if bin.SplitDebug {
+		switch toolchain.LinkerFlavor() {
+		case Ld, LdLld:
+			flags = append(flags, "--build-id")
+		case Gcc, Clang:
+			flags = append(flags, "-Wl,--build-id")
+		default:
+			core.Fatal("SplitDebug is not supported by toolchain '%s'", toolchain.Name())
+		}
+		linkOut = bin.unstripped()
+	} else if bin.Strip {
+		if toolchain.LinkerFlavor() == LldLink {
+			core.Fatal("Strip is not supported by toolchain '%s'", toolchain.Name())
+		}
+		linkOut = bin.unstripped()
+	}
+
 	ctx.AddBuildStepWithRule(core.BuildStepWithRule{
-		Outs: []core.OutPath{bin.Out},
+		Outs: []core.OutPath{linkOut},
 		Ins:  ins,
 		Rule: bin.ldRule(),
 		Variables: map[string]string{
@@ -662,6 +1314,85 @@ func (bin Binary) build(ctx core.Context) {
 			"postFlags": strings.Join(bin.LinkerFlagsPost, " "),
 		},
 	})
+
+	if bin.SplitDebug {
+		bin.splitDebug(ctx)
+	} else if bin.Strip {
+		bin.strip(ctx)
+	}
+}
+
+// strip removes all symbols and debug information of the unstripped binary.
+func (bin Binary) strip(ctx core.Context) {
+	toolchain := toolchainOrDefault(bin.Toolchain)
+	objcopy := toolCommand(toolchain, toolchain.ObjcopyCommand())
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   bin.Out,
+		In:    bin.unstripped(),
+		Cmd:   fmt.Sprintf("%s --strip-all %q %q", objcopy, bin.unstripped(), bin.Out),
+		Descr: fmt.Sprintf("STRIP (toolchain: %s) %s", toolchain.Name(), bin.Out.Relative()),
+	})
+}
+
+// splitDebug extracts the debug information of the unstripped binary into the debug file
+// and strips the binary, linking it to the debug file.
+func (bin Binary) splitDebug(ctx core.Context) {
+	toolchain := toolchainOrDefault(bin.Toolchain)
+	objcopy := toolCommand(toolchain, toolchain.ObjcopyCommand())
+
+	stripFlag := "--strip-debug"
+	if bin.Strip {
+		stripFlag = "--strip-all"
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   bin.DebugFile(),
+		In:    bin.unstripped(),
+		Cmd:   fmt.Sprintf("%s --only-keep-debug %q %q", objcopy, bin.unstripped(), bin.DebugFile()),
+		Descr: fmt.Sprintf("OBJCOPY (toolchain: %s) %s", toolchain.Name(), bin.DebugFile().Relative()),
+	})
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   bin.Out,
+		Ins:   []core.Path{bin.unstripped(), bin.DebugFile()},
+		Cmd:   fmt.Sprintf("%s %s --add-gnu-debuglink=%q %q %q", objcopy, stripFlag, bin.DebugFile(), bin.unstripped(), bin.Out),
+		Descr: fmt.Sprintf("STRIP (toolchain: %s) %s", toolchain.Name(), bin.Out.Relative()),
+	})
+}
+
+// uniqueLinkLibraries removes libraries that are linked more than once, e.g. because they
+// are listed in both Deps and DepsPost. The last occurrence of each library is kept, since
+// a static library only resolves the references of the objects and libraries before it.
+func uniqueLinkLibraries(libs []Library) []Library {
+	seen := map[string]bool{}
+	result := []Library{}
+	for i := len(libs) - 1; i >= 0; i-- {
+		key := ""
+		if libs[i].pkgConfig != "" {
+			key = "pkg-config:" + libs[i].pkgConfig
+		} else {
+			key = libs[i].linkOutput().Absolute()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append([]Library{libs[i]}, result...)
+	}
+	return result
+}
+
+// Outputs returns the artifacts a Binary produces for the user, so that intermediate
+// objects and libraries are not reported as outputs of the target.
+func (bin Binary) Outputs() []core.Path {
+	if bin.SplitDebug {
+		return []core.Path{bin.Out, bin.DebugFile()}
+	}
+	return []core.Path{bin.Out}
+}
+
+func (bin Binary) Output() core.OutPath {
+	return bin.Out
 }
 
 func (bin Binary) Run(args []string) string {
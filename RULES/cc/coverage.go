@@ -0,0 +1,38 @@
+package cc
+
+import (
+	"fmt"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+// GcovData describes the coverage data written by running binaries that are compiled and
+// linked with --coverage, to merge it into a core.CoverageReport with lcov. The .gcda
+// files are written next to the object files, so Dirs are the build directories holding
+// the object files of the binaries.
+type GcovData struct {
+	Dirs []core.OutPath
+}
+
+// CoverageData for GcovData.
+func (data GcovData) CoverageData() []core.OutPath {
+	return data.Dirs
+}
+
+// CoverageTool for GcovData.
+func (data GcovData) CoverageTool() string {
+	return "gcov"
+}
+
+// CoverageReportCmd for GcovData captures the coverage data of all directories with lcov
+// and writes an HTML report with genhtml.
+func (data GcovData) CoverageReportCmd(dirs []core.OutPath, dir core.OutPath) string {
+	info := dir.WithSuffix("/coverage.info")
+	captures := []string{}
+	for _, d := range dirs {
+		captures = append(captures, fmt.Sprintf("--directory %q", d))
+	}
+	return fmt.Sprintf("lcov --quiet --capture %s --output-file %q && genhtml --quiet %q --output-directory %q",
+		strings.Join(captures, " "), info, info, dir)
+}
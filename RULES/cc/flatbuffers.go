@@ -0,0 +1,84 @@
+package cc
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&FlatbufferLibrary{})
+}
+
+var flatcFlag = core.StringFlag{
+	Name:        "cc-flatc",
+	Description: "FlatBuffers schema compiler used to generate C++ headers for cc.FlatbufferLibrary targets",
+	DefaultFn:   func() string { return "flatc" },
+}.Register()
+
+// FlatbufferLibrary generates C++ headers from .fbs schemas. The generated code is
+// header-only, so the resulting Library does not compile any sources; it only exports
+// the generated headers to its dependents.
+type FlatbufferLibrary struct {
+	Out     core.OutPath
+	Schemas []core.Path
+
+	// FlatBuffers runtime library (headers) the generated code depends on.
+	Deps []Dep
+
+	Toolchain Toolchain
+}
+
+// genDir is the directory the generated headers are written to. It is exported as an
+// include directory to dependents.
+func (fb FlatbufferLibrary) genDir() core.OutPath {
+	return fb.Out.WithSuffix("_fbs")
+}
+
+func (fb FlatbufferLibrary) generatedHdrs() []core.OutPath {
+	hdrs := []core.OutPath{}
+	for _, schema := range fb.Schemas {
+		name := strings.TrimSuffix(path.Base(schema.Relative()), ".fbs")
+		hdrs = append(hdrs, fb.genDir().WithSuffix("/"+name+"_generated.h"))
+	}
+	return hdrs
+}
+
+func (fb FlatbufferLibrary) library() Library {
+	hdrs := []core.Path{}
+	for _, hdr := range fb.generatedHdrs() {
+		hdrs = append(hdrs, hdr)
+	}
+
+	return Library{
+		Out:           fb.Out,
+		GeneratedHdrs: hdrs,
+		Includes:      []core.Path{fb.genDir()},
+		Deps:          fb.Deps,
+		Toolchain:     fb.Toolchain,
+	}
+}
+
+// Build a FlatbufferLibrary.
+func (fb FlatbufferLibrary) Build(ctx core.Context) {
+	if fb.Out == nil {
+		core.Fatal("Out field is required for cc.FlatbufferLibrary")
+	}
+
+	ctx.WithTrace("flatbuffers:"+fb.Out.Relative(), func(ctx core.Context) {
+		ctx.AddBuildStep(core.BuildStep{
+			Outs:  fb.generatedHdrs(),
+			Ins:   fb.Schemas,
+			Cmd:   fmt.Sprintf("%s --cpp -I %q -o %q %s", flatcFlag.Value(), core.SourcePath(""), fb.genDir(), joinQuoted(fb.Schemas)),
+			Descr: fmt.Sprintf("FLATC %s", fb.genDir().Relative()),
+		})
+		fb.library().Build(ctx)
+	})
+}
+
+// CcLibrary for FlatbufferLibrary returns the header-only library exporting the generated headers.
+func (fb FlatbufferLibrary) CcLibrary(toolchain Toolchain) Library {
+	return fb.library().CcLibrary(toolchain)
+}
@@ -0,0 +1,73 @@
+package cc
+
+import (
+	"fmt"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&FormatCheck{})
+}
+
+var clangFormatFlag = core.StringFlag{
+	Name:        "cc-clang-format",
+	Description: "clang-format binary used for cc.FormatCheck targets",
+	DefaultFn:   func() string { return "clang-format" },
+}.Register()
+
+var formatApplyFlag = core.BoolFlag{
+	Name:        "cc-format-apply",
+	Description: "Reformat the sources of cc.FormatCheck targets in place instead of checking them",
+	DefaultFn:   func() bool { return false },
+}.Register()
+
+// FormatCheck checks that sources are formatted according to clang-format. The sources
+// of Libs are checked in addition to Srcs. Out lists the offending files, and the build
+// fails if there are any.
+type FormatCheck struct {
+	Out  core.OutPath
+	Srcs []core.Path
+	Libs []Library
+}
+
+// srcs returns the sources to check, without generated sources.
+func (check FormatCheck) srcs() []core.Path {
+	srcs := append([]core.Path{}, check.Srcs...)
+	for _, lib := range check.Libs {
+		srcs = append(srcs, lib.Srcs...)
+	}
+	return uniquePaths(srcs)
+}
+
+// Build a FormatCheck.
+func (check FormatCheck) Build(ctx core.Context) {
+	if check.Out == nil {
+		core.Fatal("Out field is required for cc.FormatCheck")
+	}
+
+	results := []core.Path{}
+	for _, src := range check.srcs() {
+		// Each result lists the checked source if it is not formatted correctly, and is
+		// empty otherwise.
+		result := check.Out.WithSuffix(".d/" + src.Relative() + ".format")
+		cmd := fmt.Sprintf("if %s --dry-run --Werror %q; then : > %q; else echo %q > %q; fi", clangFormatFlag.Value(), src, result, src.Relative(), result)
+		if formatApplyFlag.Value() {
+			cmd = fmt.Sprintf("%s -i %q && : > %q", clangFormatFlag.Value(), src, result)
+		}
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   result,
+			In:    src,
+			Cmd:   cmd,
+			Descr: fmt.Sprintf("FORMAT %s", src.Relative()),
+		})
+		results = append(results, result)
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   check.Out,
+		Ins:   results,
+		Cmd:   fmt.Sprintf("cat /dev/null %s > %q && test ! -s %q", joinQuoted(results), check.Out, check.Out),
+		Descr: fmt.Sprintf("FORMAT CHECK %s", check.Out.Relative()),
+	})
+}
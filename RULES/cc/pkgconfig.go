@@ -0,0 +1,70 @@
+package cc
+
+import (
+	"os/exec"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+var pkgConfigFlag = core.StringFlag{
+	Name:        "cc-pkg-config",
+	Description: "pkg-config binary used to resolve cc.PkgConfig dependencies",
+	DefaultFn:   func() string { return "pkg-config" },
+}.Register()
+
+// pkgConfigCache holds the output of pkg-config invocations, keyed by their arguments.
+var pkgConfigCache = map[string][]string{}
+
+// PkgConfig is a dependency on a library described by pkg-config, e.g. a system library.
+// pkg-config is run when the build files are generated. Its compile flags are added to
+// the sources of dependents, and its link flags to binaries depending on it.
+type PkgConfig struct {
+	// Name of the pkg-config module.
+	Name string
+
+	// Static links the module's private dependencies too, for static linking.
+	Static bool
+}
+
+func runPkgConfig(args ...string) []string {
+	key := strings.Join(args, " ")
+	if result, ok := pkgConfigCache[key]; ok {
+		return result
+	}
+
+	output, err := exec.Command(pkgConfigFlag.Value(), args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			core.Fatal("pkg-config %s failed: %s", key, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		core.Fatal("pkg-config %s failed: %s", key, err)
+	}
+
+	result := strings.Fields(string(output))
+	pkgConfigCache[key] = result
+	return result
+}
+
+// CcLibrary for PkgConfig returns a Library without outputs that carries the flags from
+// pkg-config.
+func (pkg PkgConfig) CcLibrary(toolchain Toolchain) Library {
+	if pkg.Name == "" {
+		core.Fatal("Name field is required for cc.PkgConfig")
+	}
+
+	// Check for the module first, to fail with a clear error if it is not installed.
+	runPkgConfig("--print-errors", "--exists", pkg.Name)
+
+	libsArgs := []string{"--libs"}
+	if pkg.Static {
+		libsArgs = append(libsArgs, "--static")
+	}
+
+	return Library{
+		Toolchain: toolchain,
+		pkgConfig: pkg.Name,
+		pkgCFlags: runPkgConfig("--cflags", pkg.Name),
+		pkgLibs:   runPkgConfig(append(libsArgs, pkg.Name)...),
+	}
+}
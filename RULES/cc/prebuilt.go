@@ -0,0 +1,62 @@
+package cc
+
+import (
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&PrebuiltLibrary{})
+}
+
+// PrebuiltLibrary is a static or shared library that is not built from sources, e.g. a
+// vendor library. It is copied into the build directory, and dependents link against
+// the copy like against any other Library.
+type PrebuiltLibrary struct {
+	// Lib is the .a archive or .so shared library.
+	Lib core.Path
+
+	// Includes are the include directories for the library's headers.
+	Includes []core.Path
+
+	// Deps are the libraries the prebuilt library depends on.
+	Deps []Dep
+
+	// AlwaysLink links all objects of a static library into dependents.
+	AlwaysLink bool
+}
+
+// out returns the copy of Lib in the build directory. It is placed in a directory of its
+// own, so that it is distinct from Lib if that is generated in the build directory too.
+func (lib PrebuiltLibrary) out() core.OutPath {
+	return lib.Lib.WithPrefix("prebuilt/")
+}
+
+// isShared reports whether Lib is a shared library, based on its file name.
+func (lib PrebuiltLibrary) isShared() bool {
+	return strings.HasSuffix(lib.Lib.Relative(), ".so") || strings.Contains(lib.Lib.Relative(), ".so.")
+}
+
+// Build a PrebuiltLibrary.
+func (lib PrebuiltLibrary) Build(ctx core.Context) {
+	lib.CcLibrary(DefaultToolchain()).Build(ctx)
+}
+
+// CcLibrary for PrebuiltLibrary returns a Library linking the copied library. The same
+// library is used with all toolchains.
+func (lib PrebuiltLibrary) CcLibrary(toolchain Toolchain) Library {
+	if lib.Lib == nil {
+		core.Fatal("Lib field is required for cc.PrebuiltLibrary")
+	}
+
+	return Library{
+		Out:        lib.out(),
+		Includes:   lib.Includes,
+		Deps:       lib.Deps,
+		Shared:     lib.isShared(),
+		AlwaysLink: lib.AlwaysLink && !lib.isShared(),
+		Toolchain:  toolchain,
+		prebuilt:   lib.Lib,
+	}
+}
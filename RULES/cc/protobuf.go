@@ -0,0 +1,142 @@
+package cc
+
+import (
+	"fmt"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&ProtobufLibrary{})
+}
+
+var protocFlag = core.StringFlag{
+	Name:        "cc-protoc",
+	Description: "Protocol buffer compiler used to generate C++ code for cc.ProtobufLibrary targets",
+	DefaultFn:   func() string { return "protoc" },
+}.Register()
+
+var grpcPluginFlag = core.StringFlag{
+	Name:        "cc-grpc-cpp-plugin",
+	Description: "protoc plugin used to generate C++ gRPC services for cc.ProtobufLibrary targets",
+	DefaultFn:   func() string { return "grpc_cpp_plugin" },
+}.Register()
+
+// ProtobufLibrary generates C++ code from .proto files and compiles it into a Library.
+// Imports in the .proto files are resolved relative to the workspace source directory.
+type ProtobufLibrary struct {
+	Out    core.OutPath
+	Protos []core.Path
+	Deps   []Dep
+
+	// Protobuf runtime library the generated code is linked against.
+	Runtime Dep
+
+	// Grpc additionally generates gRPC service code, which is linked against GrpcRuntime.
+	Grpc        bool
+	GrpcRuntime Dep
+
+	Toolchain Toolchain
+}
+
+// genDir is the directory the generated code is written to. It is exported as an
+// include directory to dependents.
+func (pb ProtobufLibrary) genDir() core.OutPath {
+	return pb.Out.WithSuffix("_pb")
+}
+
+func (pb ProtobufLibrary) generatedFile(proto core.Path, suffix string) core.OutPath {
+	return pb.genDir().WithSuffix("/" + strings.TrimSuffix(proto.Relative(), ".proto") + suffix)
+}
+
+func (pb ProtobufLibrary) generatedSrcs() []core.Path {
+	srcs := []core.Path{}
+	for _, proto := range pb.Protos {
+		srcs = append(srcs, pb.generatedFile(proto, ".pb.cc"))
+		if pb.Grpc {
+			srcs = append(srcs, pb.generatedFile(proto, ".grpc.pb.cc"))
+		}
+	}
+	return srcs
+}
+
+func (pb ProtobufLibrary) generatedHdrs() []core.Path {
+	hdrs := []core.Path{}
+	for _, proto := range pb.Protos {
+		hdrs = append(hdrs, pb.generatedFile(proto, ".pb.h"))
+		if pb.Grpc {
+			hdrs = append(hdrs, pb.generatedFile(proto, ".grpc.pb.h"))
+		}
+	}
+	return hdrs
+}
+
+func (pb ProtobufLibrary) library() Library {
+	deps := append([]Dep{}, pb.Deps...)
+	if pb.Runtime != nil {
+		deps = append(deps, pb.Runtime)
+	}
+	if pb.Grpc {
+		if pb.GrpcRuntime == nil {
+			core.Fatal("GrpcRuntime field is required for cc.ProtobufLibrary with Grpc enabled")
+		}
+		deps = append(deps, pb.GrpcRuntime)
+	}
+
+	return Library{
+		Out:           pb.Out,
+		GeneratedSrcs: pb.generatedSrcs(),
+		GeneratedHdrs: pb.generatedHdrs(),
+		Includes:      []core.Path{pb.genDir()},
+		Deps:          deps,
+		Toolchain:     pb.Toolchain,
+	}
+}
+
+func (pb ProtobufLibrary) generate(ctx core.Context) {
+	outs := []core.OutPath{}
+	for _, proto := range pb.Protos {
+		outs = append(outs, pb.generatedFile(proto, ".pb.cc"), pb.generatedFile(proto, ".pb.h"))
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Outs:  outs,
+		Ins:   pb.Protos,
+		Cmd:   fmt.Sprintf("%s --proto_path=%q --cpp_out=%q %s", protocFlag.Value(), core.SourcePath(""), pb.genDir(), joinQuoted(pb.Protos)),
+		Descr: fmt.Sprintf("PROTOC %s", pb.genDir().Relative()),
+	})
+
+	if !pb.Grpc {
+		return
+	}
+
+	grpcOuts := []core.OutPath{}
+	for _, proto := range pb.Protos {
+		grpcOuts = append(grpcOuts, pb.generatedFile(proto, ".grpc.pb.cc"), pb.generatedFile(proto, ".grpc.pb.h"))
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Outs:  grpcOuts,
+		Ins:   pb.Protos,
+		Cmd:   fmt.Sprintf("%s --proto_path=%q --grpc_out=%q --plugin=protoc-gen-grpc=\"$$(command -v %s)\" %s", protocFlag.Value(), core.SourcePath(""), pb.genDir(), grpcPluginFlag.Value(), joinQuoted(pb.Protos)),
+		Descr: fmt.Sprintf("PROTOC (grpc) %s", pb.genDir().Relative()),
+	})
+}
+
+// Build a ProtobufLibrary.
+func (pb ProtobufLibrary) Build(ctx core.Context) {
+	if pb.Out == nil {
+		core.Fatal("Out field is required for cc.ProtobufLibrary")
+	}
+
+	ctx.WithTrace("protobuf:"+pb.Out.Relative(), func(ctx core.Context) {
+		pb.generate(ctx)
+		pb.library().Build(ctx)
+	})
+}
+
+// CcLibrary for ProtobufLibrary returns the library compiling the generated code.
+func (pb ProtobufLibrary) CcLibrary(toolchain Toolchain) Library {
+	return pb.library().CcLibrary(toolchain)
+}
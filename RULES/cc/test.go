@@ -0,0 +1,61 @@
+package cc
+
+import (
+	"fmt"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&Test{})
+	core.AssertIsTestableTarget(&Test{})
+}
+
+// Test is a Binary that is run as a test.
+type Test struct {
+	Binary
+
+	// Framework is the test framework the binary uses. With "gtest", the JUnit report is
+	// written by GoogleTest itself. Otherwise it is derived from the exit status and output.
+	Framework string
+
+	// JunitReport writes the results of the test to the JUnit XML file JunitOutput().
+	JunitReport bool
+}
+
+// JunitOutput returns the JUnit XML file written by the test, if JunitReport is set. It is
+// only written when the test is run, e.g. with dbt test, and is not an output of any build
+// step, so it cannot be built or depended on.
+func (test Test) JunitOutput() core.OutPath {
+	return test.Out.WithSuffix(".junit.xml")
+}
+
+func (test Test) logOutput() core.OutPath {
+	return test.Out.WithSuffix(".test.log")
+}
+
+func (test Test) Test(args []string) string {
+	if !test.JunitReport {
+		return test.Run(args)
+	}
+
+	report := test.JunitOutput()
+	switch test.Framework {
+	case "gtest":
+		return test.Run(append([]string{fmt.Sprintf("--gtest_output=xml:%s", report)}, args...))
+	case "":
+		log := test.logOutput()
+		name := test.Out.Relative()
+		return fmt.Sprintf("{ %s > %q 2>&1; status=$$?; cat %q; { "+
+			"echo '<?xml version=\"1.0\" encoding=\"UTF-8\"?>'; "+
+			"echo \"<testsuite name=\\\"%s\\\" tests=\\\"1\\\" failures=\\\"$$([ $$status -eq 0 ] && echo 0 || echo 1)\\\">\"; "+
+			"echo '  <testcase classname=\"%s\" name=\"%s\">'; "+
+			"[ $$status -eq 0 ] || echo \"    <failure message=\\\"exit status $$status\\\"/>\"; "+
+			"echo '    <system-out><![CDATA['; sed 's/]]>/]]]]><![CDATA[>/g' %q; echo '    ]]></system-out>'; "+
+			"echo '  </testcase>'; echo '</testsuite>'; } > %q; exit $$status; }",
+			test.Run(args), log, log, name, name, name, log, report)
+	default:
+		core.Fatal("Unsupported test framework '%s' for cc.Test", test.Framework)
+	}
+	return ""
+}
@@ -8,6 +8,10 @@ import (
 	"dbt-rules/RULES/core"
 )
 
+// LinkerFlavor selects the command line syntax of the archiver and the linker of a
+// toolchain. It does not depend on the target operating system: LldLink uses the MSVC
+// syntax (/out:), all other flavors the GNU syntax, including toolchains that target
+// Windows with GNU tools like MinGW.
 type LinkerFlavor int
 
 const (
@@ -69,6 +73,42 @@ func ToolchainFreestanding(toolchain Toolchain) bool {
 	return false
 }
 
+// ToolchainEnv returns the environment variables to be set for every invocation of the
+// toolchain's tools, if the toolchain defines any.
+func ToolchainEnv(toolchain Toolchain) map[string]string {
+	if tce, ok := toolchain.(interface{ Env() map[string]string }); ok {
+		return tce.Env()
+	}
+	return nil
+}
+
+// ToolchainObjC reports whether the toolchain compiles Objective-C and Objective-C++
+// sources (.m and .mm).
+func ToolchainObjC(toolchain Toolchain) bool {
+	if tco, ok := toolchain.(interface{ SupportsObjC() bool }); ok {
+		return tco.SupportsObjC()
+	}
+	return false
+}
+
+// toolCommand prefixes the given tool with the environment variable assignments
+// required by the toolchain, sorted by name. The result is escaped for ninja.
+func toolCommand(toolchain Toolchain, tool string) string {
+	env := ToolchainEnv(toolchain)
+	names := []string{}
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	assignments := []string{}
+	for _, name := range names {
+		value := strings.ReplaceAll(env[name], "$", "$$")
+		assignments = append(assignments, fmt.Sprintf("%s=%q", name, value))
+	}
+	return ninjaEscape(strings.Join(append(assignments, tool), " "))
+}
+
 // Toolchain represents a C++ toolchain.
 type GccToolchain struct {
 	Ar      core.GlobalPath
@@ -88,6 +128,17 @@ type GccToolchain struct {
 	AsCompilerFlags  []string
 	LinkerFlags      []string
 
+	// Environment variables set for every invocation of the tools (e.g. GCC_EXEC_PREFIX).
+	EnvVars map[string]string
+
+	// Sysroot is the root directory of the target system's headers and libraries, passed
+	// to the compilers and the linker with --sysroot.
+	Sysroot core.Path
+
+	// ObjC enables compiling Objective-C (.m) and Objective-C++ (.mm) sources, which
+	// requires compilers built with Objective-C support, e.g. Apple Clang.
+	ObjC bool
+
 	ToolchainName string
 	ArchName      string
 	TargetName    string
@@ -113,6 +164,10 @@ func (gcc GccToolchain) Freestanding() bool {
 	return false
 }
 
+func (gcc GccToolchain) SupportsObjC() bool {
+	return gcc.ObjC
+}
+
 func (gcc GccToolchain) CCompiler() string {
 	return fmt.Sprintf("%q", gcc.Cc)
 }
@@ -137,8 +192,20 @@ func (gcc GccToolchain) ObjcopyCommand() string {
 	return fmt.Sprintf("%q", gcc.Objcopy)
 }
 
+func (gcc GccToolchain) Env() map[string]string {
+	return gcc.EnvVars
+}
+
+// sysrootFlags returns the flags selecting the toolchain's sysroot, if any.
+func (gcc GccToolchain) sysrootFlags() []string {
+	if gcc.Sysroot == nil {
+		return []string{}
+	}
+	return []string{fmt.Sprintf("--sysroot=%q", gcc.Sysroot)}
+}
+
 func (gcc GccToolchain) CFlags() []string {
-	result := gcc.CCompilerFlags
+	result := append(append([]string{}, gcc.CCompilerFlags...), gcc.sysrootFlags()...)
 	for _, inc := range gcc.Includes {
 		result = append(result, "-isystem", fmt.Sprintf("%q", inc))
 	}
@@ -146,7 +213,7 @@ func (gcc GccToolchain) CFlags() []string {
 }
 
 func (gcc GccToolchain) CxxFlags() []string {
-	result := gcc.CxxCompilerFlags
+	result := append(append([]string{}, gcc.CxxCompilerFlags...), gcc.sysrootFlags()...)
 	for _, inc := range gcc.Includes {
 		result = append(result, "-isystem", fmt.Sprintf("%q", inc))
 	}
@@ -158,7 +225,7 @@ func (gcc GccToolchain) AsFlags() []string {
 }
 
 func (gcc GccToolchain) LdFlags() []string {
-	return gcc.LinkerFlags
+	return append(append([]string{}, gcc.LinkerFlags...), gcc.sysrootFlags()...)
 }
 
 func (gcc GccToolchain) NewWithStdLib(includes []core.Path, deps []Dep, linkerScript core.Path, toolchainName string) GccToolchain {
@@ -180,6 +247,8 @@ func (gcc GccToolchain) Name() string {
 	return gcc.ToolchainName
 }
 
+// LinkerFlavor of a GccToolchain is always Ld, since GCC toolchains use the GNU archiver
+// and linker, whatever system they target.
 func (gcc GccToolchain) LinkerFlavor() LinkerFlavor {
 	return Ld
 }
@@ -1,8 +1,9 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
-	"hash/crc32"
 	"io/ioutil"
 	"os"
 	"path"
@@ -12,6 +13,9 @@ import (
 	"unicode"
 )
 
+// Pool limits how many build steps assigned to it can run concurrently. Steps that access
+// a shared resource (e.g. a license server or a device) can be serialized by using a pool
+// with depth 1.
 type Pool struct {
 	Name  string
 	Depth uint
@@ -21,10 +25,37 @@ var ConsolePool Pool = Pool{
 	Name: "console",
 }
 
+var strictOutputsFlag = BoolFlag{
+	Name:        "strict-outputs",
+	Description: "Fail if a selected public target produces no outputs, which usually indicates a bug such as empty sources",
+	DefaultFn:   func() bool { return false },
+}.Register()
+
+var splitNinjaFileFlag = BoolFlag{
+	Name:        "split-ninja-file",
+	Description: "Write the build steps of each top-level package to a separate ninja file included with subninja, which ninja parses faster for large builds",
+	DefaultFn:   func() bool { return false },
+}.Register()
+
 type Context interface {
 	AddBuildStep(BuildStep)
 	AddBuildStepWithRule(BuildStepWithRule)
 	Cwd() OutPath
+
+	// SourcePath returns a path relative to the workspace source directory,
+	// equivalent to the free function core.SourcePath.
+	SourcePath(rel string) Path
+
+	// TempDir returns a directory in the build tree for the intermediate files of the build
+	// step with the given outputs. It is derived from the outputs, so it is the same across
+	// builds and distinct for each step. The step must create the directory itself, and it
+	// is not an output of the step, so that the step may remove it when it is done.
+	TempDir(outs ...OutPath) OutPath
+
+	// GetFlag returns the resolved value of the flag with the given name as a string, and
+	// whether such a flag is registered.
+	GetFlag(name string) (string, bool)
+
 	BuildChild(c BuildInterface)
 
 	// WithTrace calls the given function, with the given value added
@@ -40,24 +71,57 @@ type Context interface {
 	// Obtains a registered rule (if it exists). The boolean is true if it exists
 	GetCompDbRule(name string) (*BuildRule, bool)
 
+	// IsSelected reports whether the target with the given path was selected on the command line.
+	IsSelected(targetPath string) bool
+
+	// DeclarePool declares a ninja pool, e.g. for rules that assign their steps to a pool
+	// with a "pool" rule variable. Pools of build steps are declared automatically, and
+	// each pool is declared only once in the ninja file.
+	DeclarePool(name string, depth int)
+
 	registerPool(pool Pool) error
 }
 
 // BuildStep represents one build step (i.e., one build command).
 // Each BuildStep produces `Out` and `Outs` from `Ins` and `In` by running `Cmd`.
 type BuildStep struct {
-	Out          OutPath
-	Outs         []OutPath
-	In           Path
-	Ins          []Path
-	Depfile      OutPath
+	Out  OutPath
+	Outs []OutPath
+	In   Path
+	Ins  []Path
+
+	// Depfile is a Makefile-style dependency file written by Cmd or Script, which lists
+	// additional inputs that are only known when the step runs. For Data, the step writes
+	// the depfile itself.
+	Depfile OutPath
+
 	Cmd          string
 	Script       string
 	Data         string
 	DataFileMode os.FileMode
 	Descr        string
-	Phony        bool
-	Pool         *Pool
+
+	// AlwaysRun makes the step depend on an always-dirty input, so that ninja runs it on
+	// every build, e.g. for version stamping or license checks. Use restat or compare the
+	// outputs before replacing them to avoid rebuilding the dependents each time.
+	AlwaysRun bool
+
+	// Phony has the same effect as AlwaysRun.
+	Phony bool
+
+	Pool *Pool
+
+	// ExtraVariables are additional ninja variables for the step, e.g. "restat". They are
+	// emitted verbatim and must not redefine the variables derived from the other fields.
+	ExtraVariables map[string]string
+
+	// Dyndep is a ninja dyndep file generated by another build step, which declares
+	// additional inputs and outputs of this step that are only known at build time.
+	Dyndep OutPath
+
+	// Retries is the number of times the command is run again if it fails, e.g. for tools
+	// that fail transiently when the license server is unavailable.
+	Retries int
 }
 
 type BuildRule struct {
@@ -73,6 +137,9 @@ type BuildStepWithRule struct {
 	Variables    map[string]string
 	Rule         BuildRule
 	Phony        bool
+	Pool         *Pool
+	Dyndep       OutPath
+	Retries      int
 	traces       [][]string
 }
 
@@ -109,6 +176,12 @@ type outputsInterface interface {
 	Outputs() []Path
 }
 
+// OutputInterface is implemented by targets with a primary output, so that other
+// rules can consume the output of a target programmatically.
+type OutputInterface interface {
+	Output() OutPath
+}
+
 type descriptionInterface interface {
 	Description() string
 }
@@ -192,6 +265,7 @@ type context struct {
 	compDbBuildRules map[string]*BuildRule
 	nestedBuild      bool
 	pools            map[string]uint
+	selectedTargets  map[string]bool
 }
 
 func newContext(vars map[string]interface{}) *context {
@@ -201,6 +275,8 @@ func newContext(vars map[string]interface{}) *context {
 		buildSteps:       map[string]*BuildStepWithRule{},
 		compDbBuildRules: map[string]*BuildRule{},
 		nestedBuild:      false,
+		pools:            map[string]uint{},
+		selectedTargets:  map[string]bool{},
 	}
 	return ctx
 }
@@ -245,12 +321,17 @@ func (ctx *context) AddBuildStep(step BuildStep) {
 
 	if data != "" {
 		buffer := []byte(data)
-		hash := crc32.ChecksumIEEE([]byte(buffer))
-		dataFileName := fmt.Sprintf("%08X", hash)
+		hash := sha256.Sum256(buffer)
+		dataFileName := fmt.Sprintf("%X", hash[:16])
 		dataFilePath = path.Join(filepath.Dir(input.OutputDir), "DATA", dataFileName)
 		if err := os.MkdirAll(filepath.Dir(dataFilePath), os.ModePerm); err != nil {
 			Fatal("Failed to create directory for data files: %s", err)
 		}
+		// Data files are shared by all steps with the same content, so an existing file
+		// with a different content would silently break the steps using it.
+		if existing, err := ioutil.ReadFile(dataFilePath); err == nil && !bytes.Equal(existing, buffer) {
+			Fatal("Data file %s already exists with different content", dataFilePath)
+		}
 		if err := ioutil.WriteFile(dataFilePath, buffer, dataFileMode); err != nil {
 			Fatal("Failed to write data file: %s", err)
 		}
@@ -259,7 +340,13 @@ func (ctx *context) AddBuildStep(step BuildStep) {
 	if step.Script != "" {
 		step.Cmd = dataFilePath
 	} else if step.Data != "" {
-		step.Cmd = fmt.Sprintf("cp %q %q", dataFilePath, step.Out)
+		// The output is only updated if its content changes, which restat below picks up
+		// to skip the steps depending on it.
+		step.Cmd = fmt.Sprintf("cmp -s %q %q || cp %q %q", dataFilePath, step.Out, dataFilePath, step.Out)
+		if step.Depfile != nil {
+			// The only input of the copy is the data file itself.
+			step.Cmd = fmt.Sprintf("{ %s; } && echo %q > %q", step.Cmd, fmt.Sprintf("%s: %s", step.Out, dataFilePath), step.Depfile)
+		}
 	}
 
 	rule := BuildRule{
@@ -271,18 +358,24 @@ func (ctx *context) AddBuildStep(step BuildStep) {
 	if step.Depfile != nil {
 		rule.Variables["depfile"] = ninjaEscape(step.Depfile.Absolute())
 	}
-	if step.Pool != nil {
-		if err := ctx.registerPool(*step.Pool); err != nil {
-			Fatal("Failed to register ninja pool: %v", err)
+	for name, value := range step.ExtraVariables {
+		if _, exists := rule.Variables[name]; exists || name == "pool" {
+			Fatal("extra variable '%s' conflicts with a variable of the build step", name)
 		}
-		rule.Variables["pool"] = ninjaEscape(step.Pool.Name)
+		rule.Variables[name] = value
+	}
+	if _, exists := rule.Variables["restat"]; !exists && step.Data != "" {
+		rule.Variables["restat"] = "1"
 	}
 
 	ctx.AddBuildStepWithRule(BuildStepWithRule{
-		Outs:  step.outs(),
-		Ins:   step.ins(),
-		Rule:  rule,
-		Phony: step.Phony,
+		Outs:    step.outs(),
+		Ins:     step.ins(),
+		Rule:    rule,
+		Phony:   step.Phony || step.AlwaysRun,
+		Pool:    step.Pool,
+		Dyndep:  step.Dyndep,
+		Retries: step.Retries,
 	})
 }
 
@@ -292,6 +385,28 @@ func (ctx *context) AddBuildStepWithRule(step BuildStepWithRule) {
 		return
 	}
 
+	outs := map[string]bool{}
+	for _, out := range step.Outs {
+		outs[out.Absolute()] = true
+	}
+	for _, in := range step.Ins {
+		if outs[in.Absolute()] {
+			Fatal("build step lists %s as both input and output: %s", in.Absolute(), strings.Join(ctx.Trace(), " --> "))
+		}
+	}
+
+	if step.Retries < 0 {
+		Fatal("negative number of retries for build step: %d", step.Retries)
+	} else if step.Retries > 0 {
+		step.Rule = retryRule(step.Rule, step.Retries)
+	}
+
+	if step.Pool != nil {
+		if err := ctx.registerPool(*step.Pool); err != nil {
+			Fatal("Failed to register ninja pool: %v", err)
+		}
+	}
+
 	if prevStep, ok := ctx.buildSteps[step.Outs[0].Absolute()]; ok {
 		if err := stepsAreEquivalent(&step, prevStep); err != nil {
 			Fatal("Second incompatible build step for output %s: %s", step.Outs[0].Absolute(), err)
@@ -331,11 +446,44 @@ func (ctx *context) AddBuildStepWithRule(step BuildStepWithRule) {
 	}
 }
 
+// retryRule returns a copy of rule whose command is run up to retries more times if it
+// fails. Named rules are renamed, since they may be shared with steps without retries. The
+// command runs in a subshell so that an exit in it does not skip the retries.
+func retryRule(rule BuildRule, retries int) BuildRule {
+	variables := map[string]string{}
+	for name, value := range rule.Variables {
+		variables[name] = value
+	}
+	variables["command"] = fmt.Sprintf("for attempt in $$(seq 0 %d); do ( %s ) && break; [ $$attempt -lt %d ] || exit 1; echo \"Command failed, retrying ($$((attempt + 1))/%d)\" >&2; done", retries, rule.Variables["command"], retries, retries)
+
+	name := rule.Name
+	if name != "" {
+		name = fmt.Sprintf("%s_retry%d", name, retries)
+	}
+	return BuildRule{Name: name, Variables: variables}
+}
+
 // Cwd returns the build directory of the current target.
 func (ctx *context) Cwd() OutPath {
 	return ctx.cwd
 }
 
+func (ctx *context) SourcePath(rel string) Path {
+	return SourcePath(rel)
+}
+
+func (ctx *context) TempDir(outs ...OutPath) OutPath {
+	if len(outs) == 0 {
+		Fatal("cannot create a temporary directory for a build step without outputs")
+	}
+	// Outputs are unique to a build step, so the first one identifies the step.
+	return outs[0].WithSuffix(".tmp")
+}
+
+func (ctx *context) GetFlag(name string) (string, bool) {
+	return resolvedFlagValue(name)
+}
+
 func (ctx *context) BuildChild(c BuildInterface) {
 	nb := ctx.nestedBuild
 	ctx.nestedBuild = true
@@ -343,6 +491,15 @@ func (ctx *context) BuildChild(c BuildInterface) {
 	ctx.nestedBuild = nb
 }
 
+func (ctx *context) DeclarePool(name string, depth int) {
+	if depth < 0 {
+		Fatal("Pool %q cannot have a negative depth", name)
+	}
+	if err := ctx.registerPool(Pool{Name: name, Depth: uint(depth)}); err != nil {
+		Fatal("Failed to register ninja pool: %v", err)
+	}
+}
+
 func (ctx *context) registerPool(pool Pool) error {
 	if pool.Name == "" {
 		return fmt.Errorf("Cannot register a pool with an empty name")
@@ -382,18 +539,19 @@ func (ctx *context) handleTarget(targetPath string, target BuildInterface) {
 	printOuts := []string{}
 	if iface, ok := target.(outputsInterface); ok {
 		for _, out := range iface.Outputs() {
-			relPath, _ := filepath.Rel(input.WorkingDir, out.Absolute())
-			printOuts = append(printOuts, relPath)
+			printOuts = append(printOuts, RelToWorkingDir(out))
 		}
 	} else {
 		for out := range ctx.leafOutputs {
-			relPath, _ := filepath.Rel(input.WorkingDir, out.Absolute())
-			printOuts = append(printOuts, relPath)
+			printOuts = append(printOuts, RelToWorkingDir(out))
 		}
 	}
 	sort.Strings(printOuts)
 
 	if len(printOuts) == 0 {
+		if strictOutputsFlag.Value() && ctx.selectedTargets[targetPath] {
+			Fatal("selected target '%s' produces no outputs", targetPath)
+		}
 		printOuts = []string{"<no outputs produced>"}
 	}
 
@@ -475,6 +633,18 @@ func stepsAreEquivalent(a, b *BuildStepWithRule) error {
 		}
 	}
 
+	if (a.Pool == nil) != (b.Pool == nil) || (a.Pool != nil && *a.Pool != *b.Pool) {
+		return fmt.Errorf("different pool")
+	}
+
+	if (a.Dyndep == nil) != (b.Dyndep == nil) || (a.Dyndep != nil && a.Dyndep.Absolute() != b.Dyndep.Absolute()) {
+		return fmt.Errorf("different dyndep file")
+	}
+
+	if a.Retries != b.Retries {
+		return fmt.Errorf("different number of retries")
+	}
+
 	if a.Rule.Name != b.Rule.Name {
 		return fmt.Errorf("different build rule")
 	}
@@ -491,11 +661,6 @@ func stepsAreEquivalent(a, b *BuildStepWithRule) error {
 }
 
 func (ctx *context) ninjaFile() string {
-	type kv struct {
-		k string
-		v string
-	}
-
 	sortedBuildRules := func(m map[string]*BuildStepWithRule) []string {
 		keys := []string{}
 		for key, _ := range m {
@@ -505,25 +670,30 @@ func (ctx *context) ninjaFile() string {
 		return keys
 	}
 
-	sortedKvs := func(m map[string]string) []kv {
-		keys := []kv{}
-		for key, _ := range m {
-			keys = append(keys, kv{key, m[key]})
-		}
-		sort.Slice(keys, func(l, r int) bool { return keys[l].k < keys[r].k })
-		return keys
-	}
-
 	ninjaFile := &strings.Builder{}
 	buildKeys := sortedBuildRules(ctx.buildSteps)
 
+	for _, step := range ctx.buildSteps {
+		if step.Dyndep != nil {
+			// dyndep bindings require ninja 1.10.
+			fmt.Fprintf(ninjaFile, "ninja_required_version = 1.10\n\n")
+			break
+		}
+	}
+
 	fmt.Fprintf(ninjaFile, "build __phony__: phony\n\n")
 
 	fmt.Fprintf(ninjaFile, "# pools\n\n")
 
-	for poolName, poolDepth := range ctx.pools {
+	poolNames := []string{}
+	for poolName := range ctx.pools {
+		poolNames = append(poolNames, poolName)
+	}
+	sort.Strings(poolNames)
+
+	for _, poolName := range poolNames {
 		fmt.Fprintf(ninjaFile, "pool %s\n", ninjaEscape(poolName))
-		fmt.Fprintf(ninjaFile, "  depth = %u\n\n", poolDepth)
+		fmt.Fprintf(ninjaFile, "  depth = %d\n\n", ctx.pools[poolName])
 	}
 
 	fmt.Fprintf(ninjaFile, "# build rules\n\n")
@@ -543,7 +713,7 @@ func (ctx *context) ninjaFile() string {
 		seenRules[step.Rule.Name] = true
 
 		fmt.Fprintf(ninjaFile, "rule %s\n", step.Rule.Name)
-		for _, kv := range sortedKvs(step.Rule.Variables) {
+		for _, kv := range sortedVariables(step.Rule.Variables) {
 			fmt.Fprintf(ninjaFile, "  %s = %s\n", kv.k, kv.v)
 		}
 		fmt.Fprint(ninjaFile, "\n\n")
@@ -551,6 +721,7 @@ func (ctx *context) ninjaFile() string {
 
 	fmt.Fprintf(ninjaFile, "# build steps\n\n")
 
+	fragments := map[string]*strings.Builder{}
 	seenSteps := map[*BuildStepWithRule]bool{}
 	for _, key := range buildKeys {
 		step := ctx.buildSteps[key]
@@ -559,40 +730,27 @@ func (ctx *context) ninjaFile() string {
 		}
 		seenSteps[step] = true
 
-		outs := []string{}
-		for _, out := range step.Outs {
-			outs = append(outs, ninjaEscape(out.Absolute()))
-		}
-
-		ins := []string{}
-		for _, in := range step.Ins {
-			ins = append(ins, ninjaEscape(in.Absolute()))
-		}
-		if step.Phony {
-			ins = append(ins, "__phony__")
+		if !splitNinjaFileFlag.Value() {
+			writeNinjaBuildStep(ninjaFile, step)
+			continue
 		}
-
-		orderDeps := []string{}
-		for _, in := range step.OrderDeps {
-			orderDeps = append(orderDeps, ninjaEscape(in.Absolute()))
-		}
-
-		implicitDeps := []string{}
-		for _, in := range step.ImplicitDeps {
-			implicitDeps = append(implicitDeps, ninjaEscape(in.Absolute()))
+		pkg := stepPackage(step)
+		if _, ok := fragments[pkg]; !ok {
+			fragments[pkg] = &strings.Builder{}
 		}
+		writeNinjaBuildStep(fragments[pkg], step)
+	}
 
-		for i, trace := range step.traces {
-			fmt.Fprintf(ninjaFile, "# trace: %s\n", strings.Join(trace, " --> "))
-			if i == 10 {
-				fmt.Fprintf(ninjaFile, "# (skipped %d additional traces)\n", len(step.traces)-10)
-				break
-			}
+	if len(fragments) > 0 {
+		pkgs := []string{}
+		for pkg := range fragments {
+			pkgs = append(pkgs, pkg)
 		}
+		sort.Strings(pkgs)
 
-		fmt.Fprintf(ninjaFile, "build %s: %s %s | %s || %s\n", strings.Join(outs, " "), step.Rule.Name, strings.Join(ins, " "), strings.Join(implicitDeps, " "), strings.Join(orderDeps, " "))
-		for _, kv := range sortedKvs(step.Variables) {
-			fmt.Fprintf(ninjaFile, "  %s = %s\n", kv.k, kv.v)
+		// Rules and pools declared above are visible in the included files.
+		for _, pkg := range pkgs {
+			fmt.Fprintf(ninjaFile, "subninja %s\n", ninjaEscape(writeNinjaFragment(pkg, fragments[pkg].String())))
 		}
 		fmt.Fprint(ninjaFile, "\n\n")
 	}
@@ -600,7 +758,7 @@ func (ctx *context) ninjaFile() string {
 	fmt.Fprintf(ninjaFile, "# targets\n\n")
 	for i, target := range ctx.targetRules {
 		fmt.Fprintf(ninjaFile, "rule __target%d\n", i)
-		for _, kv := range sortedKvs(target.Variables) {
+		for _, kv := range sortedVariables(target.Variables) {
 			fmt.Fprintf(ninjaFile, "  %s = %s\n", kv.k, kv.v)
 		}
 		fmt.Fprintf(ninjaFile, "\n")
@@ -611,6 +769,93 @@ func (ctx *context) ninjaFile() string {
 	return ninjaFile.String()
 }
 
+// writeNinjaBuildStep writes the build statement of a step.
+func writeNinjaBuildStep(w *strings.Builder, step *BuildStepWithRule) {
+	outs := []string{}
+	for _, out := range step.Outs {
+		outs = append(outs, ninjaEscape(out.Absolute()))
+	}
+
+	ins := []string{}
+	for _, in := range step.Ins {
+		ins = append(ins, ninjaEscape(in.Absolute()))
+	}
+	if step.Phony {
+		ins = append(ins, "__phony__")
+	}
+
+	orderDeps := []string{}
+	for _, in := range step.OrderDeps {
+		orderDeps = append(orderDeps, ninjaEscape(in.Absolute()))
+	}
+	if step.Dyndep != nil {
+		// ninja requires the dyndep file to be an input of the step.
+		orderDeps = append(orderDeps, ninjaEscape(step.Dyndep.Absolute()))
+	}
+
+	implicitDeps := []string{}
+	for _, in := range step.ImplicitDeps {
+		implicitDeps = append(implicitDeps, ninjaEscape(in.Absolute()))
+	}
+
+	for i, trace := range step.traces {
+		fmt.Fprintf(w, "# trace: %s\n", strings.Join(trace, " --> "))
+		if i == 10 {
+			fmt.Fprintf(w, "# (skipped %d additional traces)\n", len(step.traces)-10)
+			break
+		}
+	}
+
+	fmt.Fprintf(w, "build %s: %s %s | %s || %s\n", strings.Join(outs, " "), step.Rule.Name, strings.Join(ins, " "), strings.Join(implicitDeps, " "), strings.Join(orderDeps, " "))
+	for _, kv := range sortedVariables(step.Variables) {
+		fmt.Fprintf(w, "  %s = %s\n", kv.k, kv.v)
+	}
+	if step.Pool != nil {
+		fmt.Fprintf(w, "  pool = %s\n", ninjaEscape(step.Pool.Name))
+	}
+	if step.Dyndep != nil {
+		fmt.Fprintf(w, "  dyndep = %s\n", ninjaEscape(step.Dyndep.Absolute()))
+	}
+	fmt.Fprint(w, "\n\n")
+}
+
+type kv struct {
+	k string
+	v string
+}
+
+// sortedVariables returns the ninja variables sorted by name.
+func sortedVariables(m map[string]string) []kv {
+	keys := []kv{}
+	for key, _ := range m {
+		keys = append(keys, kv{key, m[key]})
+	}
+	sort.Slice(keys, func(l, r int) bool { return keys[l].k < keys[r].k })
+	return keys
+}
+
+// stepPackage returns the top-level package of the target that first added a step.
+func stepPackage(step *BuildStepWithRule) string {
+	if len(step.traces) == 0 || len(step.traces[0]) == 0 {
+		return "__root__"
+	}
+	targetPath := strings.TrimPrefix(step.traces[0][0], "target:")
+	return strings.SplitN(strings.TrimLeft(targetPath, "/"), "/", 2)[0]
+}
+
+// writeNinjaFragment writes the build steps of a package to a ninja file in the output
+// directory of the build configuration, and returns its path.
+func writeNinjaFragment(pkg string, content string) string {
+	fragmentPath := path.Join(input.OutputDir, "NINJA", pkg+".ninja")
+	if err := os.MkdirAll(filepath.Dir(fragmentPath), os.ModePerm); err != nil {
+		Fatal("Failed to create directory for ninja files: %s", err)
+	}
+	if err := ioutil.WriteFile(fragmentPath, []byte(content), 0644); err != nil {
+		Fatal("Failed to write ninja file: %s", err)
+	}
+	return fragmentPath
+}
+
 func (ctx *context) RegisterCompDbRule(rule *BuildRule) {
 	ctx.compDbBuildRules[rule.Name] = rule
 }
@@ -620,6 +865,10 @@ func (ctx *context) GetCompDbRule(name string) (*BuildRule, bool) {
 	return buildRule, ok
 }
 
+func (ctx *context) IsSelected(targetPath string) bool {
+	return ctx.selectedTargets[targetPath]
+}
+
 func ninjaEscape(s string) string {
 	return strings.ReplaceAll(s, " ", "$ ")
 }
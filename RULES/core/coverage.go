@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+)
+
+// CoverageReportInterface is implemented by targets whose coverage data can be merged into
+// a CoverageReport. The data of all targets with the same CoverageTool is merged by the
+// command of the first of them.
+type CoverageReportInterface interface {
+	// CoverageData returns the coverage databases or directories written by the target.
+	CoverageData() []OutPath
+	// CoverageTool names the kind of coverage data, e.g. "gcov" or "questa".
+	CoverageTool() string
+	// CoverageReportCmd returns a command merging the given coverage data and writing
+	// the report into dir.
+	CoverageReportCmd(data []OutPath, dir OutPath) string
+}
+
+// CoverageReport merges the coverage data of `Targets` and writes a report for each kind
+// of coverage data into a subdirectory of `Out` named after the tool. The coverage data is
+// written by running the targets, which ninja does not track, so the reports are written
+// again on every build.
+type CoverageReport struct {
+	Out     OutPath
+	Targets []CoverageReportInterface
+}
+
+// Build for CoverageReport.
+func (rep CoverageReport) Build(ctx Context) {
+	tools := []string{}
+	targets := map[string]CoverageReportInterface{}
+	data := map[string][]OutPath{}
+	for _, target := range rep.Targets {
+		tool := target.CoverageTool()
+		if _, ok := targets[tool]; !ok {
+			tools = append(tools, tool)
+			targets[tool] = target
+		}
+		data[tool] = append(data[tool], target.CoverageData()...)
+	}
+
+	if len(tools) == 0 {
+		Fatal("coverage report %s has no targets", rep.Out.Relative())
+	}
+
+	for _, tool := range tools {
+		dir := rep.Out.WithSuffix("/" + tool)
+		stamp := rep.Out.WithSuffix("/" + tool + ".done")
+		ctx.AddBuildStep(BuildStep{
+			Out:       stamp,
+			Cmd:       fmt.Sprintf("rm -rf %q && mkdir -p %q && %s && touch %q", dir, dir, targets[tool].CoverageReportCmd(data[tool], dir), stamp),
+			Descr:     fmt.Sprintf("COVERAGE %s", dir.Relative()),
+			AlwaysRun: true,
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 )
 
 const flagsFileName = "FLAGS.json"
+const exportedFlagsFileName = "FLAGS.export.json"
 
 var (
 	flagValues      = getFlagValues()
@@ -17,17 +18,28 @@ var (
 	registeredFlags = map[string]flagInterface{}
 )
 
+var exportFlagsFlag = StringFlag{
+	Name:          "export-flags",
+	Description:   "Export the resolved flag values into FLAGS.export.json in the build directory. 'changed' only exports flags that differ from their default value",
+	DefaultFn:     func() string { return "off" },
+	AllowedValues: []string{"off", "changed", "all"},
+}.Register()
+
 type flagInfo struct {
 	Description   string
 	Type          string
 	AllowedValues []string
 	Value         string
+
+	// Default is the default value of the flag, empty if it has none.
+	Default string
 }
 
 type flagInterface interface {
 	info() flagInfo
 	setFromString(string)
 	setToDefault() bool
+	defaultValue() (string, bool)
 }
 
 type StringFlag struct {
@@ -51,13 +63,21 @@ func (flag StringFlag) Register() *StringFlag {
 }
 
 func (flag *StringFlag) info() flagInfo {
-	return flagInfo{flag.Description, "string", flag.AllowedValues, flag.value}
+	defaultValue, _ := flag.defaultValue()
+	return flagInfo{flag.Description, "string", flag.AllowedValues, flag.value, defaultValue}
 }
 
 func (flag *StringFlag) setFromString(value string) {
 	flag.value = value
 }
 
+func (flag *StringFlag) defaultValue() (string, bool) {
+	if flag.DefaultFn != nil {
+		return flag.DefaultFn(), true
+	}
+	return "", false
+}
+
 func (flag *StringFlag) setToDefault() bool {
 	if flag.DefaultFn != nil {
 		flag.value = flag.DefaultFn()
@@ -86,7 +106,8 @@ func (flag BoolFlag) Register() *BoolFlag {
 }
 
 func (flag *BoolFlag) info() flagInfo {
-	return flagInfo{flag.Description, "bool", []string{"true", "false"}, strconv.FormatBool(flag.value)}
+	defaultValue, _ := flag.defaultValue()
+	return flagInfo{flag.Description, "bool", []string{"true", "false"}, strconv.FormatBool(flag.value), defaultValue}
 }
 
 func (flag *BoolFlag) setFromString(value string) {
@@ -100,6 +121,13 @@ func (flag *BoolFlag) setFromString(value string) {
 	}
 }
 
+func (flag *BoolFlag) defaultValue() (string, bool) {
+	if flag.DefaultFn != nil {
+		return strconv.FormatBool(flag.DefaultFn()), true
+	}
+	return "", false
+}
+
 func (flag *BoolFlag) setToDefault() bool {
 	if flag.DefaultFn != nil {
 		flag.value = flag.DefaultFn()
@@ -133,7 +161,8 @@ func (flag *IntFlag) info() flagInfo {
 	for _, value := range flag.AllowedValues {
 		allowedValues = append(allowedValues, strconv.FormatInt(value, 10))
 	}
-	return flagInfo{flag.Description, "int", allowedValues, strconv.FormatInt(flag.value, 10)}
+	defaultValue, _ := flag.defaultValue()
+	return flagInfo{flag.Description, "int", allowedValues, strconv.FormatInt(flag.value, 10), defaultValue}
 }
 
 func (flag *IntFlag) setFromString(value string) {
@@ -144,6 +173,13 @@ func (flag *IntFlag) setFromString(value string) {
 	flag.value = i64
 }
 
+func (flag *IntFlag) defaultValue() (string, bool) {
+	if flag.DefaultFn != nil {
+		return strconv.FormatInt(flag.DefaultFn(), 10), true
+	}
+	return "", false
+}
+
 func (flag *IntFlag) setToDefault() bool {
 	if flag.DefaultFn != nil {
 		flag.value = flag.DefaultFn()
@@ -172,7 +208,8 @@ func (flag FloatFlag) Register() *FloatFlag {
 }
 
 func (flag *FloatFlag) info() flagInfo {
-	return flagInfo{flag.Description, "float", []string{}, strconv.FormatFloat(flag.value, 'f', -1, 64)}
+	defaultValue, _ := flag.defaultValue()
+	return flagInfo{flag.Description, "float", []string{}, strconv.FormatFloat(flag.value, 'f', -1, 64), defaultValue}
 }
 
 func (flag *FloatFlag) setFromString(value string) {
@@ -183,6 +220,13 @@ func (flag *FloatFlag) setFromString(value string) {
 	flag.value = f64
 }
 
+func (flag *FloatFlag) defaultValue() (string, bool) {
+	if flag.DefaultFn != nil {
+		return strconv.FormatFloat(flag.DefaultFn(), 'f', -1, 64), true
+	}
+	return "", false
+}
+
 func (flag *FloatFlag) setToDefault() bool {
 	if flag.DefaultFn != nil {
 		flag.value = flag.DefaultFn()
@@ -251,9 +295,59 @@ func lockAndGetFlags(storePersistedFlags bool) map[string]flagInfo {
 		}
 	}
 
+	exportFlags(flagValues)
+
 	return flagInfo
 }
 
+// resolvedFlagValue returns the value of the flag with the given name, and whether such a
+// flag is registered. Flag values are only final once all flags are registered and locked.
+func resolvedFlagValue(name string) (string, bool) {
+	if !flagsLocked {
+		Fatal("flag '%s' read by name before all flags were registered", name)
+	}
+	flag, exists := registeredFlags[name]
+	if !exists {
+		return "", false
+	}
+	return flag.info().Value, true
+}
+
+// exportFlags writes the resolved flag values to a file in the FLAGS.json format, if
+// requested via the export-flags flag. The file can be dropped into another build
+// directory as FLAGS.json to reproduce the build with the exact same flags.
+func exportFlags(flagValues map[string]string) {
+	if exportFlagsFlag.Value() == "off" {
+		return
+	}
+
+	exportedValues := map[string]string{}
+	for name, value := range flagValues {
+		if name == exportFlagsFlag.Name {
+			continue
+		}
+		if exportFlagsFlag.Value() == "changed" {
+			if defaultValue, ok := registeredFlags[name].defaultValue(); ok && defaultValue == value {
+				continue
+			}
+		}
+		exportedValues[name] = value
+	}
+
+	data, err := json.MarshalIndent(exportedValues, "", "  ")
+	if err != nil {
+		Fatal("failed to marshal exported flag values: %s", err)
+	}
+	exportFilePath := path.Join(input.OutputDir, exportedFlagsFileName)
+	if err := os.MkdirAll(filepath.Dir(exportFilePath), os.ModePerm); err != nil {
+		Fatal("Failed to create directory for exported flags file: %s", err)
+	}
+	err = ioutil.WriteFile(exportFilePath, data, fileMode)
+	if err != nil {
+		Fatal("failed to write exported flag values: %s", err)
+	}
+}
+
 func getFlagValues() map[string]string {
 	mergedFlags := map[string]string{}
 
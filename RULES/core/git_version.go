@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+)
+
+// GitVersion stamps the output of `git describe` into `Out`. Since the state of the git
+// repository is not tracked by ninja, the version is re-determined on every build. `Out`
+// is only rewritten when the version changes.
+//
+// If `Macro` is set, `Out` is a C header defining `Macro` as a string literal holding the
+// version (e.g. for use in cc.Library.GeneratedHdrs). Otherwise, `Out` contains the plain
+// version string.
+type GitVersion struct {
+	Out   OutPath
+	Macro string
+
+	// Repository to describe. Defaults to the workspace source directory.
+	Repo Path
+}
+
+// Build for GitVersion.
+func (ver GitVersion) Build(ctx Context) {
+	repo := ver.Repo
+	if repo == nil {
+		repo = SourcePath("")
+	}
+
+	format := `%s\n`
+	if ver.Macro != "" {
+		format = fmt.Sprintf(`#pragma once\n#define %s "%%s"\n`, ver.Macro)
+	}
+
+	tmp := ver.Out.WithSuffix(".tmp")
+	cmd := fmt.Sprintf("version=$$(git -C %q describe --tags --dirty --always) && printf '%s' \"$$version\" > %q && { cmp -s %q %q && rm %q || mv %q %q; }",
+		repo, format, tmp, tmp, ver.Out, tmp, tmp, ver.Out)
+
+	ctx.AddBuildStep(BuildStep{
+		Out:       ver.Out,
+		Cmd:       cmd,
+		Descr:     fmt.Sprintf("GIT VERSION %s", ver.Out.Relative()),
+		AlwaysRun: true,
+		// Steps depending on Out only run again if the version changed.
+		ExtraVariables: map[string]string{"restat": "1"},
+	})
+}
+
+func (ver GitVersion) Output() OutPath {
+	return ver.Out
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const depGraphFileName = "deps.dot"
+
+var depGraphFlag = StringFlag{
+	Name:          "dep-graph",
+	Description:   "Write the dependency graph of the build as a Graphviz DOT file into the build directory",
+	DefaultFn:     func() string { return "off" },
+	AllowedValues: []string{"off", "outputs", "targets"},
+}.Register()
+
+// stepTargets returns the sorted set of targets that requested the given build step.
+func stepTargets(step *BuildStepWithRule) []string {
+	targets := map[string]bool{}
+	for _, trace := range step.traces {
+		if len(trace) > 0 && strings.HasPrefix(trace[0], "target:") {
+			targets[strings.TrimPrefix(trace[0], "target:")] = true
+		}
+	}
+
+	result := []string{}
+	for target := range targets {
+		result = append(result, target)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// dotFile renders the recorded build steps as a Graphviz DOT graph. Nodes are the
+// files of the build and edges point from the inputs of a step to its outputs. If
+// collapseTargets is set, nodes are targets instead and edges point from the targets
+// producing an input of a step to the targets requesting the step.
+func (ctx *context) dotFile(collapseTargets bool) string {
+	edges := map[string]bool{}
+	nodes := map[string]bool{}
+
+	addEdge := func(from, to string) {
+		nodes[from] = true
+		nodes[to] = true
+		if from != to {
+			edges[fmt.Sprintf("  %q -> %q;\n", from, to)] = true
+		}
+	}
+
+	for _, step := range ctx.buildSteps {
+		if !collapseTargets {
+			for _, out := range step.Outs {
+				nodes[out.Relative()] = true
+				for _, in := range step.Ins {
+					addEdge(in.Relative(), out.Relative())
+				}
+			}
+			continue
+		}
+
+		targets := stepTargets(step)
+		for _, target := range targets {
+			nodes[target] = true
+		}
+		for _, in := range step.Ins {
+			producer, ok := ctx.buildSteps[in.Absolute()]
+			if !ok {
+				continue
+			}
+			for _, from := range stepTargets(producer) {
+				for _, to := range targets {
+					addEdge(from, to)
+				}
+			}
+		}
+	}
+
+	sortedNodes := []string{}
+	for node := range nodes {
+		sortedNodes = append(sortedNodes, fmt.Sprintf("  %q;\n", node))
+	}
+	sort.Strings(sortedNodes)
+
+	sortedEdges := []string{}
+	for edge := range edges {
+		sortedEdges = append(sortedEdges, edge)
+	}
+	sort.Strings(sortedEdges)
+
+	dotFile := &strings.Builder{}
+	fmt.Fprintf(dotFile, "digraph deps {\n")
+	fmt.Fprint(dotFile, strings.Join(sortedNodes, ""))
+	fmt.Fprint(dotFile, strings.Join(sortedEdges, ""))
+	fmt.Fprintf(dotFile, "}\n")
+	return dotFile.String()
+}
+
+// writeDepGraph writes the dependency graph to the build directory, if requested
+// via the dep-graph flag.
+func (ctx *context) writeDepGraph() {
+	if depGraphFlag.Value() == "off" {
+		return
+	}
+
+	dotFilePath := path.Join(input.OutputDir, depGraphFileName)
+	if err := os.MkdirAll(filepath.Dir(dotFilePath), os.ModePerm); err != nil {
+		Fatal("Failed to create directory for dependency graph: %s", err)
+	}
+	data := ctx.dotFile(depGraphFlag.Value() == "targets")
+	if err := ioutil.WriteFile(dotFilePath, []byte(data), fileMode); err != nil {
+		Fatal("failed to write dependency graph: %s", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"regexp"
 	"sort"
+	"strings"
 	"unicode"
 )
 
@@ -56,21 +57,94 @@ type generatorOutput struct {
 	Flags           map[string]flagInfo
 	CompDbRules     []string
 	SelectedTargets []string
+	Completions     *completions `json:",omitempty"`
+}
+
+// completions holds the words a shell completer can suggest. They are only generated
+// when CompletionsOnly is set.
+type completions struct {
+	// Targets are all target paths, followed by the target path with a "#run" or "#test"
+	// suffix for runnable and testable targets.
+	Targets []string
+
+	// Flags are "name=value" for each allowed value of flags with allowed values, and
+	// "name=" for other flags.
+	Flags []string
+}
+
+const runSuffix = "#run"
+const testSuffix = "#test"
+
+func makeCompletions(output generatorOutput) *completions {
+	result := &completions{Targets: []string{}, Flags: []string{}}
+
+	for targetPath, info := range output.Targets {
+		result.Targets = append(result.Targets, targetPath)
+		if info.Runnable {
+			result.Targets = append(result.Targets, targetPath+runSuffix)
+		}
+		if info.Testable {
+			result.Targets = append(result.Targets, targetPath+testSuffix)
+		}
+	}
+	sort.Strings(result.Targets)
+
+	for name, info := range output.Flags {
+		if len(info.AllowedValues) == 0 {
+			result.Flags = append(result.Flags, name+"=")
+		}
+		for _, value := range info.AllowedValues {
+			result.Flags = append(result.Flags, name+"="+value)
+		}
+	}
+	sort.Strings(result.Flags)
+
+	return result
 }
 
 var input = loadInput()
 
+// TestArgs returns the arguments passed to the tests on the command line, for rules that
+// run tests as part of the build.
+func TestArgs() []string {
+	return input.TestArgs
+}
+
 // Determine the set of targets to be built.
 type targetFilter struct {
 	positiveRegexps []*regexp.Regexp
 	negativeRegexps []*regexp.Regexp
 }
 
+const rawPatternPrefix = "re:"
+const recursivePatternSuffix = "..."
+
+// patternToRegexp translates a target pattern into a regular expression.
+// Patterns ending in "..." select all targets below a package, e.g. "//foo/..." (or
+// "foo/...") selects every target under "foo". Patterns with the "re:" prefix are used
+// verbatim as regular expressions. All other patterns are regular expressions as well.
+func patternToRegexp(pattern string) string {
+	if strings.HasPrefix(pattern, rawPatternPrefix) {
+		return strings.TrimPrefix(pattern, rawPatternPrefix)
+	}
+
+	if !strings.HasSuffix(pattern, recursivePatternSuffix) {
+		return pattern
+	}
+
+	pkg := strings.TrimPrefix(strings.TrimSuffix(pattern, recursivePatternSuffix), "//")
+	pkg = strings.TrimSuffix(pkg, "/")
+	if pkg == "" {
+		return ".*"
+	}
+	return regexp.QuoteMeta(pkg) + "/.*"
+}
+
 func makeFilter() targetFilter {
 	filter := targetFilter{}
 
 	for _, pattern := range input.PositivePatterns {
-		re, err := regexp.Compile(fmt.Sprintf("^%s$", pattern))
+		re, err := regexp.Compile(fmt.Sprintf("^%s$", patternToRegexp(pattern)))
 		if err != nil {
 			Fatal("Positive target pattern '%s' is not a valid regular expression: %s.\n", pattern, err)
 		}
@@ -78,7 +152,7 @@ func makeFilter() targetFilter {
 	}
 
 	for _, pattern := range input.NegativePatterns {
-		re, err := regexp.Compile(fmt.Sprintf("^%s$", pattern))
+		re, err := regexp.Compile(fmt.Sprintf("^%s$", patternToRegexp(pattern)))
 		if err != nil {
 			Fatal("Negative target pattern '%s' is not a valid regular expression: %s.\n", pattern, err)
 		}
@@ -127,6 +201,12 @@ func GeneratorMain(vars map[string]interface{}) {
 		Flags:   lockAndGetFlags(input.PersistFlags),
 	}
 
+	// In flags mode only the flags are reported, e.g. for shell completion or other tools.
+	if input.Mode == modeFlags {
+		writeOutput(output)
+		return
+	}
+
 	filter := makeFilter()
 
 	var selectedTargets = []interface{}{}
@@ -174,9 +254,16 @@ func GeneratorMain(vars map[string]interface{}) {
 		output.Targets[targetPath] = info
 	}
 
+	if input.CompletionsOnly {
+		output.Completions = makeCompletions(output)
+	}
+
 	// Create build files.
 	if !input.CompletionsOnly {
 		ctx := newContext(vars)
+		for targetPath, info := range output.Targets {
+			ctx.selectedTargets[targetPath] = info.Selected
+		}
 
 		// Making sure targets are processed in a deterministic order
 		targetPaths := []string{}
@@ -213,6 +300,8 @@ func GeneratorMain(vars map[string]interface{}) {
 		}
 
 		output.NinjaFile = ctx.ninjaFile()
+		ctx.writeDepGraph()
+		ctx.printWhy()
 
 		output.CompDbRules = []string{}
 		for name := range ctx.compDbBuildRules {
@@ -221,7 +310,11 @@ func GeneratorMain(vars map[string]interface{}) {
 		sort.Strings(output.CompDbRules)
 	}
 
-	// Serialize generator output.
+	writeOutput(output)
+}
+
+// writeOutput serializes the generator output.
+func writeOutput(output generatorOutput) {
 	data, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
 		Fatal("failed to marshal generator output: %s", err)
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 )
@@ -144,7 +145,32 @@ func BuildPath(p string) OutPath {
 	return outPath{p}
 }
 
+// OutPathAt returns a path relative to the given subdirectory of the build directory.
+// This allows staging outputs (e.g. release artifacts) in a tree of their choice. The
+// path is placed in a subdirectory named after the toolchain, if any, to keep the outputs
+// built with different toolchains distinct, like cc does for libraries.
+func OutPathAt(dir string, toolchain interface{ Name() string }, rel string) OutPath {
+	if toolchain != nil {
+		dir = path.Join(dir, toolchain.Name())
+	}
+	p := path.Join(dir, rel)
+	if path.IsAbs(dir) || p == ".." || strings.HasPrefix(p, "../") {
+		Fatal("output path '%s' in directory '%s' is not inside the build directory", rel, dir)
+	}
+	return outPath{p}
+}
+
 // SourcePath returns a path relative to the source directory.
 func SourcePath(p string) Path {
 	return inPath{p, ""}
 }
+
+// RelToWorkingDir returns the path relative to the directory dbt was invoked from, for
+// printing it to the user. The absolute path is returned if there is no relative one.
+func RelToWorkingDir(p Path) string {
+	rel, err := filepath.Rel(input.WorkingDir, p.Absolute())
+	if err != nil {
+		return p.Absolute()
+	}
+	return rel
+}
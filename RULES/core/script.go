@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Script runs `Script` with `Interpreter` (python3 by default) and the given `Args`, e.g.
+// for code generation. The script and `Ins` are inputs of the build step, and the script
+// must write all of `Outs`.
+type Script struct {
+	Interpreter string
+	Script      Path
+	Args        []string
+	Ins         []Path
+	Outs        []OutPath
+}
+
+// Build for Script.
+func (script Script) Build(ctx Context) {
+	if len(script.Outs) == 0 {
+		Fatal("script %s has no outputs", script.Script.Relative())
+	}
+
+	interpreter := script.Interpreter
+	if interpreter == "" {
+		interpreter = "python3"
+	}
+
+	args := []string{}
+	for _, arg := range script.Args {
+		args = append(args, fmt.Sprintf("%q", arg))
+	}
+
+	ctx.AddBuildStep(BuildStep{
+		Outs:  script.Outs,
+		Ins:   append([]Path{script.Script}, script.Ins...),
+		Cmd:   strings.TrimSpace(fmt.Sprintf("%s %q %s", interpreter, script.Script, strings.Join(args, " "))),
+		Descr: fmt.Sprintf("SCRIPT %s", script.Script.Relative()),
+	})
+}
+
+func (script Script) Outputs() []Path {
+	outs := []Path{}
+	for _, out := range script.Outs {
+		outs = append(outs, out)
+	}
+	return outs
+}
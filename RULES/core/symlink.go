@@ -0,0 +1,32 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Symlink creates a symbolic link at `Link` pointing to `Target`. The link is relative,
+// so that it stays valid when the build directory is moved.
+type Symlink struct {
+	Target Path
+	Link   OutPath
+}
+
+// Build for Symlink.
+func (link Symlink) Build(ctx Context) {
+	target, err := filepath.Rel(filepath.Dir(link.Link.Absolute()), link.Target.Absolute())
+	if err != nil {
+		Fatal("cannot create a relative symlink to %s: %s", link.Target, err)
+	}
+
+	ctx.AddBuildStep(BuildStep{
+		Out:   link.Link,
+		In:    link.Target,
+		Cmd:   fmt.Sprintf("rm -f %q && ln -s %q %q", link.Link, target, link.Link),
+		Descr: fmt.Sprintf("LN %s", link.Link.Relative()),
+	})
+}
+
+func (link Symlink) Output() OutPath {
+	return link.Link
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tags generates a database of the symbols in `Srcs` for editor navigation, e.g. from the
+// sources of a cc.Library or an hdl.Library. `Format` is "ctags" (the default) or "cscope".
+type Tags struct {
+	Out    OutPath
+	Srcs   []Path
+	Format string
+}
+
+// Build for Tags.
+func (tags Tags) Build(ctx Context) {
+	srcs := []string{}
+	for _, src := range tags.Srcs {
+		srcs = append(srcs, fmt.Sprintf("%q", src))
+	}
+
+	cmd := ""
+	switch tags.Format {
+	case "", "ctags":
+		cmd = fmt.Sprintf("ctags -f %q %s", tags.Out, strings.Join(srcs, " "))
+	case "cscope":
+		cmd = fmt.Sprintf("cscope -b -k -f %q %s", tags.Out, strings.Join(srcs, " "))
+	default:
+		Fatal("Unknown tags format '%s'", tags.Format)
+	}
+
+	ctx.AddBuildStep(BuildStep{
+		Out:   tags.Out,
+		Ins:   tags.Srcs,
+		Cmd:   cmd,
+		Descr: fmt.Sprintf("TAGS %s", tags.Out.Relative()),
+	})
+}
+
+func (tags Tags) Output() OutPath {
+	return tags.Out
+}
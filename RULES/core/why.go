@@ -0,0 +1,59 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var whyFlag = StringFlag{
+	Name:        "why",
+	Description: "Print the command and the traces of the build step producing the given output, relative to the build or working directory",
+	DefaultFn:   func() string { return "" },
+}.Register()
+
+// findStep returns the build step producing the given output. Relative paths are looked up
+// in the build directory first, then in the working directory.
+func (ctx *context) findStep(output string) (string, *BuildStepWithRule) {
+	candidates := []string{output}
+	if !filepath.IsAbs(output) {
+		candidates = []string{path.Join(input.OutputDir, output), path.Join(input.WorkingDir, output)}
+	}
+
+	for _, candidate := range candidates {
+		if step, ok := ctx.buildSteps[path.Clean(candidate)]; ok {
+			return path.Clean(candidate), step
+		}
+	}
+	return "", nil
+}
+
+// printWhy prints what produces the output requested with the why flag, if any.
+func (ctx *context) printWhy() {
+	if whyFlag.Value() == "" {
+		return
+	}
+
+	output, step := ctx.findStep(whyFlag.Value())
+	if step == nil {
+		fmt.Fprintf(os.Stderr, "No build step produces '%s'.\n", whyFlag.Value())
+		return
+	}
+
+	why := &strings.Builder{}
+	fmt.Fprintf(why, "Output: %s\n", output)
+	if step.Rule.Name != "" {
+		fmt.Fprintf(why, "Rule: %s\n", step.Rule.Name)
+	}
+	fmt.Fprintf(why, "Command: %s\n", step.Rule.Variables["command"])
+	for _, kv := range sortedVariables(step.Variables) {
+		fmt.Fprintf(why, "  %s = %s\n", kv.k, kv.v)
+	}
+	fmt.Fprintf(why, "Traces:\n")
+	for _, trace := range step.traces {
+		fmt.Fprintf(why, "  %s\n", strings.Join(trace, " --> "))
+	}
+	fmt.Fprint(os.Stderr, why.String())
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// WriteFile writes static `Content` to `Out`, optionally with the given file `Mode`.
+type WriteFile struct {
+	Out     OutPath
+	Content string
+	Mode    os.FileMode
+}
+
+// Build for WriteFile.
+func (file WriteFile) Build(ctx Context) {
+	if file.Content == "" {
+		cmd := fmt.Sprintf(": > %q", file.Out)
+		if file.Mode != 0 {
+			cmd = fmt.Sprintf("%s && chmod %o %q", cmd, file.Mode.Perm(), file.Out)
+		}
+		ctx.AddBuildStep(BuildStep{
+			Out:   file.Out,
+			Cmd:   cmd,
+			Descr: fmt.Sprintf("WRITE %s", file.Out.Relative()),
+		})
+		return
+	}
+
+	ctx.AddBuildStep(BuildStep{
+		Out:          file.Out,
+		Data:         file.Content,
+		DataFileMode: file.Mode,
+		Descr:        fmt.Sprintf("WRITE %s", file.Out.Relative()),
+	})
+}
+
+func (file WriteFile) Output() OutPath {
+	return file.Out
+}
+
+func (file WriteFile) Outputs() []Path {
+	return []Path{file.Out}
+}
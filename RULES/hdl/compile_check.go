@@ -0,0 +1,119 @@
+package hdl
+
+import (
+	"fmt"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&CompileCheck{})
+}
+
+// CompileCheck compiles the sources of simulations and IPs with vlog and vcom, without
+// optimizing or running them. Compilation errors fail the build at the first source that
+// does not compile, like for simulations, so the report is only written once all sources
+// compiled. It is derived from the compile logs and lists the number of warnings of every
+// source.
+type CompileCheck struct {
+	Name        string
+	Simulations []Simulation
+	Ips         []Ip
+}
+
+// Path returns the default root path for the files of this rule.
+func (rule CompileCheck) Path() core.OutPath {
+	return core.BuildPath("/" + rule.Name)
+}
+
+// Report returns the file listing the compiled sources and their number of warnings.
+func (rule CompileCheck) Report() core.OutPath {
+	return rule.Path().WithSuffix("/compile_check.log")
+}
+
+func (rule CompileCheck) Build(ctx core.Context) {
+	sims := append([]Simulation{}, rule.Simulations...)
+	if len(rule.Ips) > 0 {
+		sims = append(sims, Simulation{Name: rule.Name, Ips: rule.Ips})
+	}
+
+	names := []string{}
+	for _, sim := range sims {
+		names = append(names, sim.Name)
+	}
+
+	deps := []core.Path{}
+	seen := map[string]bool{}
+	params := compileCheckParams{
+		Names: strings.Join(names, " "),
+		Out:   rule.Report().String(),
+	}
+	for _, sim := range sims {
+		// compile adds the global tool flags to the ToolFlags of the rule, which must not
+		// leak into the simulation target itself.
+		flags := FlagMap{}
+		for tool, flag := range sim.ToolFlags {
+			flags[tool] = flag
+		}
+		sim.ToolFlags = flags
+
+		srcs := []core.Path{}
+		for _, dep := range compile(ctx, sim) {
+			if seen[dep.String()] {
+				continue
+			}
+			seen[dep.String()] = true
+			deps = append(deps, dep)
+			if IsRtl(dep.String()) {
+				srcs = append(srcs, dep)
+			}
+		}
+
+		// The log is written by compileSrcs, for the library the source is compiled into.
+		libs := append([]string{"work"}, ipSimLibraries(sim.Ips)...)
+		for _, src := range srcs {
+			for _, lib := range libs {
+				if log := compileLog(src, lib); seen[log.String()] {
+					params.Srcs = append(params.Srcs, compileCheckSrc{
+						Src: src.Relative(),
+						Log: log.String(),
+					})
+					break
+				}
+			}
+		}
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:    rule.Report(),
+		Ins:    deps,
+		Script: core.CompileTemplate(compile_check_script_template, "compile_check", params),
+		Descr:  fmt.Sprintf("compile check: %s", strings.Join(names, " ")),
+	})
+}
+
+type compileCheckSrc struct {
+	Src string
+	Log string
+}
+
+type compileCheckParams struct {
+	Names string
+	Out   string
+	Srcs  []compileCheckSrc
+}
+
+// compile_check_script_template reads the number of warnings from the summary line of the
+// vlog and vcom logs, e.g. "Errors: 0, Warnings: 2".
+const compile_check_script_template = `#!/bin/sh
+warnings() {
+  echo "$1 ($(grep -o "Warnings: [0-9]*" "$2" | tail -n 1 | sed 's/^Warnings: //') warnings)"
+}
+{
+  echo "Sources of {{ .Names }}:"
+{{- range .Srcs }}
+  warnings "{{ .Src }}" "{{ .Log }}"
+{{- end }}
+} > {{ .Out }}
+`
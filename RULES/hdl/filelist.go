@@ -0,0 +1,69 @@
+package hdl
+
+import (
+	"fmt"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&FileList{})
+}
+
+// FileList writes the RTL sources, include directories and defines of a library and its
+// IPs to a .f file list, e.g. for static analysis tools like Verible, Verilator or Surelog.
+type FileList struct {
+	Out     core.OutPath
+	Srcs    []core.Path
+	Ips     []Ip
+	Defines DefineMap
+}
+
+// commandFileContents renders include directories, defines and sources in the .f file
+// format understood by most HDL tools.
+func commandFileContents(incs []string, defines DefineMap, srcs []core.Path) string {
+	lines := []string{}
+	for _, inc := range incs {
+		lines = append(lines, "+incdir+"+inc)
+	}
+	for _, key := range sortedStringKeys(defines) {
+		if defines[key] == "" {
+			lines = append(lines, "+define+"+key)
+		} else {
+			lines = append(lines, fmt.Sprintf("+define+%s=%s", key, defines[key]))
+		}
+	}
+	for _, src := range srcs {
+		lines = append(lines, src.String())
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (rule FileList) Build(ctx core.Context) {
+	lib := Library{
+		Srcs:   rule.Srcs,
+		IpDeps: rule.Ips,
+	}
+
+	srcs := []core.Path{}
+	for _, src := range lib.AllSources() {
+		if IsRtl(src.String()) {
+			srcs = append(srcs, src)
+		}
+	}
+	incs := []string{core.SourcePath("").String()}
+	for _, inc := range lib.AllIncDirs() {
+		incs = append(incs, inc.String())
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   rule.Out,
+		Data:  commandFileContents(incs, rule.Defines, srcs),
+		Descr: fmt.Sprintf("filelist: %s", rule.Out.Relative()),
+	})
+}
+
+func (rule FileList) Output() core.OutPath {
+	return rule.Out
+}
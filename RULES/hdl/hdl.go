@@ -71,6 +71,50 @@ type Library struct {
 	DataFiles []core.Path
 	IpDeps    []Ip
 	ToolFlags FlagMap
+
+	// LibraryName compiles the sources of the library (and of IP dependencies without
+	// their own library name) into a separate simulation library of that name, instead
+	// of the library of the simulation.
+	LibraryName string
+}
+
+// simLibraryIp is implemented by IPs that can be compiled into their own simulation
+// library.
+type simLibraryIp interface {
+	SimLibrary() string
+}
+
+// SimLibrary returns the name of the simulation library of the library, if any.
+func (lib Library) SimLibrary() string {
+	return lib.LibraryName
+}
+
+// ipSimLibrary returns the name of the simulation library the IP is compiled into, or
+// the given default library if it does not specify one.
+func ipSimLibrary(ip Ip, def string) string {
+	if v, ok := ip.(simLibraryIp); ok && v.SimLibrary() != "" {
+		return v.SimLibrary()
+	}
+	return def
+}
+
+// ipSimLibraries returns the names of the simulation libraries of the given IPs and
+// their dependencies, in order of first occurrence.
+func ipSimLibraries(ips []Ip) []string {
+	libs := []string{}
+	seen := map[string]bool{}
+	var collect func(ips []Ip)
+	collect = func(ips []Ip) {
+		for _, ip := range ips {
+			if lib := ipSimLibrary(ip, ""); lib != "" && !seen[lib] {
+				seen[lib] = true
+				libs = append(libs, lib)
+			}
+			collect(ip.Ips())
+		}
+	}
+	collect(ips)
+	return libs
 }
 
 func (lib Library) Sources() []core.Path {
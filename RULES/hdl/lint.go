@@ -0,0 +1,127 @@
+package hdl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&LintCheck{})
+}
+
+var Linter = core.StringFlag{
+	Name:        "hdl-linter",
+	Description: "Select HDL linter for hdl.LintCheck targets",
+	DefaultFn: func() string {
+		return "questa"
+	},
+	AllowedValues: []string{"questa", "verilator"},
+}.Register()
+
+// LintCheck checks the sources of a library and its IPs without building a simulation. The
+// linter output is written to a report file.
+type LintCheck struct {
+	Name    string
+	Srcs    []core.Path
+	Ips     []Ip
+	Defines DefineMap
+	Top     string
+}
+
+// Path returns the default root path for the files of this rule.
+func (rule LintCheck) Path() core.OutPath {
+	return core.BuildPath("/" + rule.Name)
+}
+
+// Report returns the file holding the linter output.
+func (rule LintCheck) Report() core.OutPath {
+	return rule.Path().WithSuffix("/lint.log")
+}
+
+func (rule LintCheck) library() Library {
+	return Library{
+		Srcs:   rule.Srcs,
+		IpDeps: rule.Ips,
+	}
+}
+
+// questaCmd lints the sources with vlog and vcom, compiling them into a scratch library.
+func (rule LintCheck) questaCmd(srcs []core.Path) string {
+	work := rule.Path().WithSuffix("/lint_work")
+	cmds := []string{fmt.Sprintf("rm -rf %s && vlib %s", work.String(), work.String())}
+
+	defines := " -define SIMULATION"
+	for _, key := range sortedStringKeys(rule.Defines) {
+		defines += " -define " + key
+		if rule.Defines[key] != "" {
+			defines += fmt.Sprintf("=%s", rule.Defines[key])
+		}
+	}
+
+	incs := " +incdir+" + core.SourcePath("").String()
+	for _, inc := range rule.library().AllIncDirs() {
+		incs += " +incdir+" + inc.String()
+	}
+	for _, src := range srcs {
+		if IsVerilog(src.String()) {
+			cmds = append(cmds, fmt.Sprintf("vlog -nologo -quiet -lint -work %s%s%s %s", work.String(), incs, defines, src.String()))
+		} else if IsVhdl(src.String()) {
+			cmds = append(cmds, fmt.Sprintf("vcom -nologo -quiet -lint -work %s %s", work.String(), src.String()))
+		}
+	}
+
+	return strings.Join(cmds, " && ")
+}
+
+// verilatorCmd lints the Verilog sources with Verilator. VHDL sources are not supported.
+func (rule LintCheck) verilatorCmd(srcs []core.Path) string {
+	cmd := "verilator --lint-only -Wall -DSIMULATION"
+	for _, key := range sortedStringKeys(rule.Defines) {
+		cmd += " -D" + key
+		if rule.Defines[key] != "" {
+			cmd += fmt.Sprintf("=%s", rule.Defines[key])
+		}
+	}
+
+	cmd += " +incdir+" + core.SourcePath("").String()
+	for _, inc := range rule.library().AllIncDirs() {
+		cmd += " +incdir+" + inc.String()
+	}
+
+	if rule.Top != "" {
+		cmd += " --top-module " + rule.Top
+	}
+
+	for _, src := range srcs {
+		if IsVerilog(src.String()) {
+			cmd += " " + src.String()
+		}
+	}
+
+	return cmd
+}
+
+func (rule LintCheck) Build(ctx core.Context) {
+	srcs := rule.library().AllSources()
+
+	cmd := ""
+	switch Linter.Value() {
+	case "questa":
+		cmd = rule.questaCmd(srcs)
+	case "verilator":
+		cmd = rule.verilatorCmd(srcs)
+	default:
+		log.Fatal(fmt.Sprintf("invalid value '%s' for hdl-linter flag", Linter.Value()))
+	}
+
+	report := rule.Report()
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   report,
+		Ins:   srcs,
+		Cmd:   fmt.Sprintf("{ %s; } > %s 2>&1 || { cat %s; rm %s; exit 1; }", cmd, report.String(), report.String(), report.String()),
+		Descr: fmt.Sprintf("lint (%s): %s", Linter.Value(), rule.Name),
+	})
+}
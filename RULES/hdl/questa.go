@@ -3,7 +3,6 @@ package hdl
 import (
 	"fmt"
 	"log"
-	"os"
 	"path"
 	"strings"
 
@@ -74,15 +73,61 @@ var Access = core.StringFlag{
 	Description: "Control access to simulation objects for debugging purposes",
 }.Register()
 
-// Coverage enables the user to run the simulation with code coverage.
+// SerializeCompile enables serializing all compile steps, for Questa versions that
+// cannot safely compile into the same library concurrently.
+var SerializeCompile = core.BoolFlag{
+	Name: "questa-serialize-compile",
+	DefaultFn: func() bool {
+		return false
+	},
+	Description: "Run at most one vlog/vcom compile step at a time",
+}.Register()
+
+// compilePool returns the pool for compile steps, if they are serialized.
+func compilePool() *core.Pool {
+	if !SerializeCompile.Value() {
+		return nil
+	}
+	return &core.Pool{Name: "questa_compile", Depth: 1}
+}
+
+// Coverage enables the user to run the simulation with code coverage, with Questa and xsim.
 var Coverage = core.BoolFlag{
 	Name: "questa-coverage",
 	DefaultFn: func() bool {
 		return false
 	},
-	Description: "Enable code-coverage database generation",
+	Description: "Enable code-coverage database generation (Questa and xsim)",
 }.Register()
 
+// CoverageTypes selects the kinds of coverage collected and reported when coverage is enabled.
+var CoverageTypes = core.StringFlag{
+	Name: "hdl-coverage-types",
+	DefaultFn: func() string {
+		return "code,cvg,assert"
+	},
+	Description: "Comma-separated kinds of coverage to collect and report: code, cvg (covergroups) and assert",
+}.Register()
+
+// coverageTypes returns the kinds of coverage selected with the hdl-coverage-types flag.
+func coverageTypes() map[string]bool {
+	types := map[string]bool{}
+	for _, kind := range strings.Split(CoverageTypes.Value(), ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case "code", "cvg", "assert":
+			types[kind] = true
+		case "":
+		default:
+			log.Fatal(fmt.Sprintf("invalid coverage type '%s' in hdl-coverage-types flag", kind))
+		}
+	}
+	if len(types) == 0 {
+		log.Fatal("hdl-coverage-types flag selects no coverage type")
+	}
+	return types
+}
+
 // Coverage enables the user to run the simulation with code coverage.
 var DumpQwavedb = core.BoolFlag{
 	Name: "questa-dump-qwavedb",
@@ -115,7 +160,7 @@ func paramFlags(rule Simulation, params string) string {
 		// Add parameters for all generics into a single string
 		for _, name := range rule.SortedParamSet(params) {
 			value := rule.Params[params][name]
-			cmd += fmt.Sprintf(" -g %s=%s", name, value)
+			cmd += fmt.Sprintf(" -g %s=%s", name, rule.paramValue(name, value))
 		}
 	}
 	return cmd
@@ -129,7 +174,8 @@ func libFlags(rule Simulation) string {
 	lib_map := map[string]bool{}
 
 	// get defaults
-	for _, lib := range append(strings.Split(SimulatorLibSearch.Value(), " "), rule.Libs...) {
+	libs := append(strings.Split(SimulatorLibSearch.Value(), " "), rule.Libs...)
+	for _, lib := range append(libs, ipSimLibraries(rule.Ips)...) {
 		if lib != "" {
 			if _, ok := lib_map[lib]; !ok {
 				lib_map[lib] = true
@@ -208,6 +254,12 @@ var rules = make(map[string]bool)
 // common_flags holds common flags used for the 'vlog', 'vcom', and 'vopt' commands.
 const common_flags = "-nologo -quiet -work work"
 
+// compileFlags returns the common flags for compiling into the given library with the
+// 'vlog' and 'vcom' commands.
+func compileFlags(work string) string {
+	return "-nologo -quiet -work " + work
+}
+
 type Target struct {
 	Name    string
 	LogFile core.OutPath
@@ -216,10 +268,13 @@ type Target struct {
 
 // Parameters of the do-file
 type doFileParams struct {
-	WaveformInit string
-	DumpVcd      bool
-	DumpVcdFile  string
-	CovFiles     string
+	WaveformInits []string
+	DumpVcd       bool
+	DumpVcdFile   string
+	CovFiles      string
+	CovCode       bool
+	CovCvg        bool
+	CovAssert     bool
 }
 
 // Do-file template
@@ -227,8 +282,8 @@ const do_file_template = `
 proc reload {} {
 	global target
 	vsim -work work $target
-	{{ if .WaveformInit }}
-		source {{ .WaveformInit }}
+	{{ range .WaveformInits }}
+		source {{ . }}
 	{{ end }}
 
 }
@@ -236,10 +291,12 @@ proc reload {} {
 set StdArithNoWarnings 1
 set NumericStdNoWarnings 1
 
-{{ if .WaveformInit }}
+{{ if .WaveformInits }}
 if [info exists gui] {
 	run 1
-	catch { source {{ .WaveformInit }} }
+	{{ range .WaveformInits }}
+	catch { source {{ . }} }
+	{{ end }}
 	assertion fail -action break
 }
 {{ end }}
@@ -248,6 +305,11 @@ if [info exists from] {
 	run $from
 }
 
+if [info exists checkpoint_at] {
+	run $checkpoint_at
+	checkpoint $checkpoint_file
+}
+
 {{ if .DumpVcd }}
 vcd file {{ .DumpVcdFile }}
 vcd add -r *
@@ -265,29 +327,49 @@ vcd flush
 
 if [info exists coverage] {
 	# Create coverage database
-	coverage save -assert -directive -cvg -codeall -testname $testcase $coverage_db.ucdb
+	coverage save {{ if .CovAssert }}-assert -directive {{ end }}{{ if .CovCvg }}-cvg {{ end }}{{ if .CovCode }}-codeall {{ end }}-testname $testcase $coverage_db.ucdb
 	# Optionally merge coverage databases
 	if {$main_coverage_db != $coverage_db} {
 		puts "Writing merged coverage database to [pwd]/$main_coverage_db.ucdb"
 		vcover merge -testassociated -output $main_coverage_db.ucdb $main_coverage_db.ucdb $coverage_db.ucdb
 	}
+	# Merge the results of all parameter sets and top-level units into a single database
+	if {$merged_coverage_db != $main_coverage_db} {
+		puts "Writing merged coverage database to [pwd]/$merged_coverage_db.ucdb"
+		if [file exists $merged_coverage_db.ucdb] {
+			vcover merge -testassociated -output $merged_coverage_db.ucdb $merged_coverage_db.ucdb $coverage_db.ucdb
+		} else {
+			vcover merge -testassociated -output $merged_coverage_db.ucdb $coverage_db.ucdb
+		}
+	}
 	# Create HTML coverage report
-	vcover report -html -output ${main_coverage_db}_covhtml \
-		-testdetails -details -assert -directive -cvg -codeAll $main_coverage_db.ucdb
+	vcover report -html -output ${merged_coverage_db}_covhtml \
+		-testdetails -details {{ if .CovAssert }}-assert -directive {{ end }}{{ if .CovCvg }}-cvg {{ end }}{{ if .CovCode }}-codeAll {{ end }}$merged_coverage_db.ucdb
+	{{ if .CovCode }}
 	# Create textual code coverage report
 	{{ if .CovFiles }}
-	vcover report -output ${main_coverage_db}_covcode.txt -srcfile={{ .CovFiles }}\
-		-codeAll $main_coverage_db.ucdb
+	vcover report -output ${merged_coverage_db}_covcode.txt -srcfile={{ .CovFiles }}\
+		-codeAll $merged_coverage_db.ucdb
 	{{ else }}
-	vcover report -output ${main_coverage_db}_covcode.txt\
-		-codeAll $main_coverage_db.ucdb
+	vcover report -output ${merged_coverage_db}_covcode.txt\
+		-codeAll $merged_coverage_db.ucdb
+	{{ end }}
+	# Create textual code coverage report of the design under test only, if it exists
+	if {[catch {vcover report -output ${merged_coverage_db}_covdut.txt -instance=$instance -recursive \
+		-codeAll $merged_coverage_db.ucdb}]} {
+		puts "No code coverage of the design under test $instance"
+	}
 	{{ end }}
+	{{ if or .CovAssert .CovCvg }}
 	# Create textual assertion coverage report
-	puts "Writing coverage report to [pwd]/${main_coverage_db}_cover.txt"
-	vcover report -output ${main_coverage_db}_cover.txt -flat -directive -cvg $main_coverage_db.ucdb
+	puts "Writing coverage report to [pwd]/${merged_coverage_db}_cover.txt"
+	vcover report -output ${merged_coverage_db}_cover.txt -flat {{ if .CovAssert }}-directive {{ end }}{{ if .CovCvg }}-cvg {{ end }}$merged_coverage_db.ucdb
+	{{ end }}
+	{{ if .CovAssert }}
 	# Create textural assertion report
-	puts "Writing assertion report to [pwd]/${main_coverage_db}_cover.txt"
-	vcover report -output ${main_coverage_db}_assert.txt -flat -assert $main_coverage_db.ucdb
+	puts "Writing assertion report to [pwd]/${merged_coverage_db}_cover.txt"
+	vcover report -output ${merged_coverage_db}_assert.txt -flat -assert $merged_coverage_db.ucdb
+	{{ end }}
 }
 
 if ![info exists gui] {
@@ -332,12 +414,64 @@ func createModelsimIni(ctx core.Context, rule Simulation, deps []core.Path) []co
 	return deps
 }
 
+// createLibrary creates and maps the simulation library of an IP, unless it exists.
+func createLibrary(ctx core.Context, work string, deps []core.Path) []core.Path {
+	lib_dir := core.BuildPath("questa_lib/" + work)
+	if !rules[lib_dir.String()] {
+		// Keep the timestamp of modelsim.ini so that mapping the library does not cause
+		// everything to be recompiled.
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   lib_dir,
+			Ins:   deps,
+			Cmd:   fmt.Sprintf("t=$$(date -R -r modelsim.ini) && vlib %s && vmap %s %s && touch -d \"$$t\" modelsim.ini", lib_dir.String(), work, lib_dir.String()),
+			Descr: fmt.Sprintf("vlib: %s", work),
+		})
+		rules[lib_dir.String()] = true
+	}
+	return append(deps, lib_dir)
+}
+
+// CommandFiles moves the include directories, defines and source of vlog calls into a .f file
+var CommandFiles = core.BoolFlag{
+	Name: "questa-command-files",
+	DefaultFn: func() bool {
+		return false
+	},
+	Description: "Pass include directories, defines and sources to vlog in .f command files instead of the command line",
+}.Register()
+
+// vlogCommandFile writes the .f command file cmdFile for compiling a Verilog source with vlog.
+func vlogCommandFile(ctx core.Context, rule Simulation, incs []core.Path, src core.Path, cmdFile core.OutPath) {
+	incDirs := []string{core.SourcePath("").String()}
+	seen := map[string]bool{}
+	for _, inc := range incs {
+		dir := path.Dir(inc.Absolute())
+		if !seen[dir] {
+			seen[dir] = true
+			incDirs = append(incDirs, dir)
+		}
+	}
+
+	defines := DefineMap{"SIMULATION": ""}
+	for key, value := range rule.Defines {
+		defines[key] = value
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   cmdFile,
+		Data:  commandFileContents(incDirs, defines, []core.Path{src}),
+		Descr: fmt.Sprintf("vlog command file: %s", cmdFile.Relative()),
+	})
+}
+
 // Create a command for running vlog on a file; the file is not part of the returned command
-func vlogCmd(ctx core.Context, rule Simulation, incs []core.Path, flags FlagMap) string {
-	cmd := "vlog " + common_flags
+func vlogCmd(ctx core.Context, rule Simulation, incs []core.Path, flags FlagMap, work string) string {
+	cmd := "vlog " + compileFlags(work)
 	cmd += libFlags(rule)
-	cmd += " +incdir+" + core.SourcePath("").String()
-	cmd += incDirFlags(incs)
+	if !CommandFiles.Value() {
+		cmd += " +incdir+" + core.SourcePath("").String()
+		cmd += incDirFlags(incs)
+	}
 
 	if flags != nil {
 		if vlog_flags, ok := flags["vlog"]; ok {
@@ -345,6 +479,10 @@ func vlogCmd(ctx core.Context, rule Simulation, incs []core.Path, flags FlagMap)
 		}
 	}
 
+	if CommandFiles.Value() {
+		return cmd
+	}
+
 	cmd += "  -define SIMULATION"
 	for _, key := range sortedStringKeys(rule.Defines) {
 		cmd += " -define " + key
@@ -357,8 +495,8 @@ func vlogCmd(ctx core.Context, rule Simulation, incs []core.Path, flags FlagMap)
 }
 
 // Create a command for running vcom on a file; the file is not part of the returned command
-func vcomCmd(ctx core.Context, rule Simulation, flags FlagMap) string {
-	cmd := "vcom " + common_flags
+func vcomCmd(ctx core.Context, rule Simulation, flags FlagMap, work string) string {
+	cmd := "vcom " + compileFlags(work)
 
 	if flags != nil {
 		if vcom_flags, ok := flags["vcom"]; ok {
@@ -369,14 +507,42 @@ func vcomCmd(ctx core.Context, rule Simulation, flags FlagMap) string {
 	return cmd
 }
 
-// compileSrcs compiles a list of sources using the specified context ctx, rule,
-// dependencies and include paths. It returns the resulting dependencies and include paths
-// that result from compiling the source files.
+// archiveLibrary returns the name under which the work library of a simulation archive is
+// mapped, which is the name of the archive without the .simlib.tar.gz suffix.
+func archiveLibrary(archive core.Path) string {
+	return strings.TrimSuffix(path.Base(archive.String()), ".simlib.tar.gz")
+}
+
+// archiveMapCmd creates a command extracting a simulation archive (see SimulationArchive)
+// and mapping the compiled libraries it contains, so that they are not compiled again. The
+// work library of the archive is mapped under the name of the archive. The libraries must
+// be listed in the Libs of a simulation to be searched.
+func archiveMapCmd(archive core.Path, log core.OutPath) string {
+	dir := core.BuildPath(archive.Relative()).WithSuffix(".libs")
+	return fmt.Sprintf("rm -rf %s && mkdir -p %s && tar xzf %s -C %s && t=$$(date -R -r modelsim.ini) && "+
+		"( for lib in $$(find %s -name _info -printf '%%h\\n'); do name=$$(basename $$lib); [ $$name != work ] || name=%s; vmap $$name $$lib || exit 1; done ) > %s && "+
+		"touch -d \"$$t\" modelsim.ini",
+		dir.String(), dir.String(), archive.String(), dir.String(), dir.String(), archiveLibrary(archive), log.String())
+}
+
+// compileLog returns the log file of compiling src into the library work. Sources compiled
+// into another library than work, e.g. by a SimulationArchive, get a log of their own, so
+// that they are compiled into each library.
+func compileLog(src core.Path, work string) core.OutPath {
+	if work == "work" {
+		return core.BuildPath(src.Relative()).WithSuffix(".log")
+	}
+	return core.BuildPath(src.Relative()).WithSuffix("." + work + ".log")
+}
+
+// compileSrcs compiles a list of sources into the library work using the specified
+// context ctx, rule, dependencies and include paths. It returns the resulting dependencies
+// and include paths that result from compiling the source files.
 func compileSrcs(ctx core.Context, rule Simulation,
-	deps []core.Path, incs []core.Path, srcs []core.Path, flags FlagMap) ([]core.Path, []core.Path) {
+	deps []core.Path, incs []core.Path, srcs []core.Path, flags FlagMap, work string) ([]core.Path, []core.Path) {
 	for _, src := range srcs {
 		// log will point to the log file to be generated when compiling the code
-		log := core.BuildPath(src.Relative()).WithSuffix(".log")
+		log := compileLog(src, work)
 		// Command will be updated to compile the source code
 		cmd := ""
 		// Tool will indicate the used tool
@@ -386,22 +552,35 @@ func compileSrcs(ctx core.Context, rule Simulation,
 			// tool will point to the tool to execute (also used for logging below)
 			if IsVerilog(src.String()) {
 				tool = "vlog"
-				cmd += vlogCmd(ctx, rule, incs, flags)
+				cmd += vlogCmd(ctx, rule, incs, flags, work)
 			} else if IsVhdl(src.String()) {
 				tool = "vcom"
-				cmd += vcomCmd(ctx, rule, flags)
+				cmd += vcomCmd(ctx, rule, flags, work)
 			}
 
 			if Lint.Value() {
 				cmd += " -lint"
 			}
 
-			cmd += " -l " + log.String() + " " + src.String()
+			if tool == "vlog" && CommandFiles.Value() {
+				// The command file is shared by all simulations compiling the source, like the log
+				cmdFile := log.WithExt("f")
+				if !rules[log.String()] {
+					vlogCommandFile(ctx, rule, incs, src, cmdFile)
+				}
+				deps = append(deps, cmdFile)
+				cmd += " -l " + log.String() + " -f " + cmdFile.String()
+			} else {
+				cmd += " -l " + log.String() + " " + src.String()
+			}
 
 		} else if IsXilinxIpCheckpoint(src.String()) {
 			tool = "vsim"
 			src = ExportXilinxIpCheckpoint(ctx, rule, src, rule.Defines, flags)
 			cmd = fmt.Sprintf("vsim -batch -do \"set t [exec date -R -r modelsim.ini]\" -do %s -do \"exec touch -d \\$$t modelsim.ini\" -do exit -logfile %s", src.String(), log.String())
+		} else if IsSimulationLibraryArchive(src.String()) {
+			tool = "vmap"
+			cmd = archiveMapCmd(src, log)
 		} else if IsHeader(src.String()) {
 			// Header files are added to the list to be able to set include directories correctly
 			incs = append(incs, src)
@@ -423,6 +602,7 @@ func compileSrcs(ctx core.Context, rule Simulation,
 					Ins:   deps,
 					Cmd:   cmd,
 					Descr: fmt.Sprintf("%s: %s", tool, src.Absolute()),
+					Pool:  compilePool(),
 				})
 
 				// Note down the created rule
@@ -453,6 +633,7 @@ func compileBlockDesign(ctx core.Context, rule Simulation, ip BlockDesign, deps
 			In:    do,
 			Cmd:   fmt.Sprintf("vsim -batch -do \"set t [exec date -R -r modelsim.ini]\" -do %s -do \"exec touch -d \\$$t modelsim.ini\" -do exit -logfile %s", do.String(), log.String()),
 			Descr: fmt.Sprintf("vsim: %s", do.Absolute()),
+			Pool:  compilePool(),
 		})
 
 		// Note down the created rule
@@ -462,9 +643,15 @@ func compileBlockDesign(ctx core.Context, rule Simulation, ip BlockDesign, deps
 	return append(deps, log)
 }
 
-// compileIp compiles the IP dependencies and the source files of a Library
+// compileIp compiles the IP dependencies and the source files of a Library into the
+// simulation library of the IP, or into work if it does not have its own.
 func compileIp(ctx core.Context, rule Simulation, ip Ip,
-	deps []core.Path, incs []core.Path, flags FlagMap) ([]core.Path, []core.Path) {
+	deps []core.Path, incs []core.Path, flags FlagMap, work string) ([]core.Path, []core.Path) {
+
+	if lib := ipSimLibrary(ip, ""); lib != "" {
+		work = lib
+		deps = createLibrary(ctx, work, deps)
+	}
 
 	// Merge tool options
 	for tool, flag := range ip.Flags() {
@@ -483,10 +670,10 @@ func compileIp(ctx core.Context, rule Simulation, ip Ip,
 
 	// Compile Ips
 	for _, sub_ip := range ip.Ips() {
-		deps, incs = compileIp(ctx, rule, sub_ip, deps, incs, flags)
+		deps, incs = compileIp(ctx, rule, sub_ip, deps, incs, flags, work)
 	}
 	// and local sources
-	deps, incs = compileSrcs(ctx, rule, deps, incs, ip.Sources(), flags)
+	deps, incs = compileSrcs(ctx, rule, deps, incs, ip.Sources(), flags, work)
 
 	if v, ok := ip.(BlockDesign); ok {
 		deps = compileBlockDesign(ctx, rule, v, deps, flags)
@@ -497,6 +684,13 @@ func compileIp(ctx core.Context, rule Simulation, ip Ip,
 
 // compile compiles the IP dependencies and source files of a simulation rule.
 func compile(ctx core.Context, rule Simulation) []core.Path {
+	return compileInto(ctx, rule, "work")
+}
+
+// compileInto compiles the IP dependencies and source files of a simulation rule into the
+// library work, which is created if it is not the default one. IPs with a simulation
+// library of their own are still compiled into that library.
+func compileInto(ctx core.Context, rule Simulation, work string) []core.Path {
 	incs := []core.Path{}
 	deps := []core.Path{}
 
@@ -520,11 +714,14 @@ func compile(ctx core.Context, rule Simulation) []core.Path {
 	}
 
 	deps = createModelsimIni(ctx, rule, deps)
+	if work != "work" {
+		deps = createLibrary(ctx, work, deps)
+	}
 
 	for _, ip := range rule.Ips {
-		deps, incs = compileIp(ctx, rule, ip, deps, incs, flags)
+		deps, incs = compileIp(ctx, rule, ip, deps, incs, flags, work)
 	}
-	deps, incs = compileSrcs(ctx, rule, deps, incs, rule.Srcs, flags)
+	deps, incs = compileSrcs(ctx, rule, deps, incs, rule.Srcs, flags, work)
 
 	return deps
 }
@@ -538,7 +735,7 @@ func optimize(ctx core.Context, rule Simulation, deps []core.Path) {
 	}
 
 	// Default for compatibility
-	tops := []string{"board"}
+	tops := []string{DefaultTop.Value()}
 	if rule.Top != "" {
 		tops = []string{rule.Top}
 	} else if len(rule.Tops) > 0 {
@@ -547,8 +744,9 @@ func optimize(ctx core.Context, rule Simulation, deps []core.Path) {
 
 	log_file_suffix := "vopt.log"
 
+	// Covergroups and assertions are collected without instrumenting the design
 	cover_flag := ""
-	if Coverage.Value() {
+	if Coverage.Value() && coverageTypes()["code"] {
 		cover_flag = "+cover"
 	}
 
@@ -647,8 +845,15 @@ func doFile(ctx core.Context, rule Simulation) {
 		CovFiles:    strings.Join(rule.ReportCovFiles(), "+"),
 	}
 
-	if rule.WaveformInit != nil {
-		params.WaveformInit = rule.WaveformInit.String()
+	if Coverage.Value() {
+		types := coverageTypes()
+		params.CovCode = types["code"]
+		params.CovCvg = types["cvg"]
+		params.CovAssert = types["assert"]
+	}
+
+	for _, init := range rule.waveformInits() {
+		params.WaveformInits = append(params.WaveformInits, init.String())
 	}
 
 	doFile := rule.Path().WithSuffix("/" + "vsim.do")
@@ -659,6 +864,24 @@ func doFile(ctx core.Context, rule Simulation) {
 	})
 }
 
+// questaCoverageDb returns the coverage database holding the merged results of all tests
+// of a simulation, as written by tests run from the build directory.
+func questaCoverageDb(rule Simulation) core.OutPath {
+	return core.BuildPath(rule.Name + ".ucdb")
+}
+
+// questaCoverageReportCmd creates a command merging coverage databases with vcover and
+// writing an HTML report into dir.
+func questaCoverageReportCmd(data []core.OutPath, dir core.OutPath) string {
+	merged := dir.WithSuffix("/merged.ucdb")
+	dbs := []string{}
+	for _, db := range data {
+		dbs = append(dbs, db.String())
+	}
+	return fmt.Sprintf("vcover merge -testassociated -output %s %s && vcover report -html -output %s -testdetails -details %s",
+		merged.String(), strings.Join(dbs, " "), dir.String(), merged.String())
+}
+
 // BuildQuesta will compile and optimize the source and IPs associated with the given
 // rule.
 func BuildQuesta(ctx core.Context, rule Simulation) {
@@ -688,6 +911,9 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 	}
 	log_file := rule.Path().WithSuffix("/" + log_file_suffix)
 
+	// Checkpoint written with -checkpoint-at, named like the log file
+	checkpoint_file := rule.Path().WithSuffix("/" + strings.TrimSuffix(log_file_suffix, "vsim.log") + "checkpoint.cpt")
+
 	// Script to execute
 	do_file := rule.Path().WithSuffix("/" + "vsim.do")
 
@@ -742,9 +968,19 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 	// This will be the name of the database created by the current run
 	coverage_db := rule.Name
 
+	// This one will hold the merged data of all parameter sets, covering all top-level
+	// units of all of them, and is used for the reports
+	merged_coverage_db := rule.Name
+
 	// Turn off output unless verbosity is activated
 	print_output := false
 
+	// Whether a checkpoint is saved with -checkpoint-at
+	checkpoint := false
+
+	// Checkpoint restored with -restore-from instead of loading the design
+	restore_from := ""
+
 	// Parse additional arguments
 	for _, arg := range args {
 		if strings.HasPrefix(arg, "-seed=") {
@@ -771,6 +1007,21 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 			} else {
 				log.Fatal("-from expects an argument of '<timesteps>[<time units>]'!")
 			}
+		} else if strings.HasPrefix(arg, "-checkpoint-at=") {
+			// Save a checkpoint of the simulation state at the given time
+			var at string
+			if _, err := fmt.Sscanf(arg, "-checkpoint-at=%s", &at); err == nil {
+				do_flags = append(do_flags, fmt.Sprintf("\"set checkpoint_at %s\"", at))
+				do_flags = append(do_flags, fmt.Sprintf("\"set checkpoint_file %s\"", checkpoint_file.String()))
+				checkpoint = true
+			} else {
+				log.Fatal("-checkpoint-at expects an argument of '<timesteps>[<time units>]'!")
+			}
+		} else if strings.HasPrefix(arg, "-restore-from=") {
+			// Resume the simulation from a checkpoint saved with -checkpoint-at
+			if _, err := fmt.Sscanf(arg, "-restore-from=%s", &restore_from); err != nil {
+				log.Fatal("-restore-from expects the path of a checkpoint file!")
+			}
 		} else if strings.HasPrefix(arg, "-to=") {
 			// Define how long to run
 			var to string
@@ -790,9 +1041,9 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 
 	cmd_echo := ""
 	if rule.Params != nil && params != "" {
-		// Update coverage database name based on parameters. Since we cannot merge
-		// different parameter sets, we have to make a dedicated main database
-		// for this parameter set.
+		// Update coverage database name based on parameters. The testcases of each
+		// parameter set are merged into a dedicated main database, which is in turn
+		// merged into the database of all parameter sets.
 		main_coverage_db = main_coverage_db + "_" + params
 		coverage_db = coverage_db + "_" + params
 		cmd_echo = "Testcase " + params
@@ -819,8 +1070,10 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 
 	do_flags = append(do_flags, fmt.Sprintf("\"set target %s\"", target))
 	do_flags = append(do_flags, fmt.Sprintf("\"set testcase %s\"", testcase))
+	do_flags = append(do_flags, fmt.Sprintf("\"set instance %s\"", rule.Instance()))
 	do_flags = append(do_flags, fmt.Sprintf("\"set main_coverage_db %s\"", main_coverage_db))
 	do_flags = append(do_flags, fmt.Sprintf("\"set coverage_db %s\"", coverage_db))
+	do_flags = append(do_flags, fmt.Sprintf("\"set merged_coverage_db %s\"", merged_coverage_db))
 
 	cmd_postamble := ""
 	cmd_pass := "PASS"
@@ -843,8 +1096,12 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 	}
 
 	if Coverage.Value() {
-		cmd_pass = cmd_pass + fmt.Sprintf(" Coverage: $$(pwd)/%s.ucdb", main_coverage_db)
-		cmd_fail = cmd_fail + fmt.Sprintf(" Coverage: $$(pwd)/%s.ucdb", main_coverage_db)
+		cmd_pass = cmd_pass + fmt.Sprintf(" Coverage: $$(pwd)/%s.ucdb", merged_coverage_db)
+		cmd_fail = cmd_fail + fmt.Sprintf(" Coverage: $$(pwd)/%s.ucdb", merged_coverage_db)
+	}
+
+	if checkpoint {
+		cmd_pass = cmd_pass + " Checkpoint: " + checkpoint_file.String()
 	}
 
 	cmd_newline := ":"
@@ -870,10 +1127,28 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 		vsim_flags = vsim_flags + " -do " + do_flag
 	}
 
+	if rule.StartupTcl != nil {
+		vsim_flags = vsim_flags + " -do " + rule.StartupTcl.String()
+	}
+
 	// Add the file as the last argument
 	vsim_flags = vsim_flags + " -do " + do_file.String()
 
-	cmd := fmt.Sprintf("{ echo -n %s && vsim %s -work work %s && echo %s; }", cmd_echo, vsim_flags, target, cmd_pass)
+	// A simulation killed on timeout fails like any other failing simulation
+	timeout := ""
+	if !gui {
+		timeout = rule.timeoutPrefix()
+	}
+
+	// A checkpoint replaces the design, restoring it in the state it was saved in
+	design := "-work work " + target
+	restore_check := ""
+	if restore_from != "" {
+		design = "-restore " + restore_from
+		restore_check = fmt.Sprintf("{ test -f %s || { echo \"Checkpoint %s not found\"; false; }; } && ", restore_from, restore_from)
+	}
+
+	cmd := fmt.Sprintf("{ echo -n %s && %s%svsim %s %s && echo %s; }", cmd_echo, restore_check, timeout, vsim_flags, design, cmd_pass)
 	if cmd_preamble == "" {
 		cmd += " " + cmd_postamble
 	} else {
@@ -891,56 +1166,7 @@ func vsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 // optionally build a chain of commands in case the rule has parameters, but
 // no parameters are specified on the command line
 func simulateQuesta(rule Simulation, args []string, gui bool) string {
-	// Optional testcase goes here
-	testcases := []string{}
-
-	// Optional parameter set goes here
-	params := []string{}
-
-	// Parse additional arguments
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "-testcases=") && rule.TestCaseGenerator != nil {
-			var testcases_arg string
-			if _, err := fmt.Sscanf(arg, "-testcases=%s", &testcases_arg); err != nil {
-				log.Fatal(fmt.Sprintf("-testcases expects a string argument!"))
-			}
-			testcases = append(testcases, strings.Split(testcases_arg, ",")...)
-		} else if strings.HasPrefix(arg, "-params=") && rule.Params != nil {
-			var params_arg string
-			if _, err := fmt.Sscanf(arg, "-params=%s", &params_arg); err != nil {
-				log.Fatal(fmt.Sprintf("-params expects a string argument!"))
-			} else {
-				for _, param := range strings.Split(params_arg, ",") {
-					if _, ok := rule.Params[param]; ok {
-						params = append(params, param)
-					}
-				}
-			}
-		}
-	}
-
-	// If no parameters have been specified, simulate them all
-	if rule.Params != nil && len(params) == 0 {
-		for _, key := range rule.SortedParams() {
-			params = append(params, key)
-		}
-	} else if len(params) == 0 {
-		params = append(params, "")
-	}
-
-	// If no testcase has been specified, simulate them all
-	if rule.TestCaseGenerator != nil && rule.TestCasesDir != nil && len(testcases) == 0 {
-		// Loop through all defined testcases in directory
-		if items, err := os.ReadDir(rule.TestCasesDir.String()); err == nil {
-			for _, item := range items {
-				testcases = append(testcases, item.Name())
-			}
-		} else {
-			log.Fatal(err)
-		}
-	} else if len(testcases) == 0 {
-		testcases = append(testcases, "")
-	}
+	params, testcases := rule.testCombinations(args)
 
 	// Final command
 	cmd := "{ :; }"
@@ -0,0 +1,60 @@
+package hdl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&SimulationArchive{})
+}
+
+// SimulationArchive compiles the sources and IPs of a simulation with Questa and packages
+// the compiled libraries into a .simlib.tar.gz archive, e.g. to deliver precompiled libraries
+// without their sources. The sources, and the IPs without a simulation library of their own,
+// are compiled into a library named after the archive, which is archived as the work library
+// together with the libraries of the IPs. Questa simulations use the libraries of an archive
+// listed in their sources instead of compiling them, and the work library of the archive is
+// mapped under the name of the archive. Library archives are only supported by Questa, xsim
+// simulations fail if one is listed in their sources.
+type SimulationArchive struct {
+	Out        core.OutPath
+	Simulation Simulation
+}
+
+func (rule SimulationArchive) Build(ctx core.Context) {
+	if !IsSimulationLibraryArchive(rule.Out.String()) {
+		log.Fatal(fmt.Sprintf("output '%s' of simulation archive is not a .simlib.tar.gz file", rule.Out.Relative()))
+	}
+
+	// compile adds the global tool flags to the ToolFlags of the rule, which must not
+	// leak into the simulation target itself.
+	sim := rule.Simulation
+	flags := FlagMap{}
+	for tool, flag := range sim.ToolFlags {
+		flags[tool] = flag
+	}
+	sim.ToolFlags = flags
+
+	work := archiveLibrary(rule.Out)
+	deps := compileInto(ctx, sim, work)
+
+	// Only the libraries of the simulation are archived, the shared work library also holds
+	// the designs of the other simulations of the build.
+	libs := append([]string{work}, ipSimLibraries(sim.Ips)...)
+	transform := fmt.Sprintf("s,^%s/,work/,;s,^%s$$,work,", work, work)
+
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   rule.Out,
+		Ins:   deps,
+		Cmd:   fmt.Sprintf("tar czf %s -C %s --transform '%s' %s", rule.Out.String(), core.BuildPath("questa_lib").String(), transform, strings.Join(libs, " ")),
+		Descr: fmt.Sprintf("tar: %s", rule.Out.Relative()),
+	})
+}
+
+func (rule SimulationArchive) Output() core.OutPath {
+	return rule.Out
+}
@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -43,6 +44,24 @@ var SimulatorLibSearch = core.StringFlag{
 	},
 }.Register()
 
+// DefaultTop is the top-level unit of simulations that set neither Top nor Tops
+var DefaultTop = core.StringFlag{
+	Name:        "hdl-default-top",
+	Description: "Top-level unit of HDL simulations that do not specify one",
+	DefaultFn: func() string {
+		return "board"
+	},
+}.Register()
+
+// DefaultDut is the instance name of the design under test in simulations that do not set Dut
+var DefaultDut = core.StringFlag{
+	Name:        "hdl-default-dut",
+	Description: "Instance name of the design under test in HDL simulations that do not specify one",
+	DefaultFn: func() string {
+		return "u_dut"
+	},
+}.Register()
+
 // FindTestCases enables parsing of source files to discover testcases
 var FindTestCases = core.BoolFlag{
 	Name: "hdl-find-testcases",
@@ -70,9 +89,27 @@ var DumpVcd = core.BoolFlag{
 	Description: "Enable output of signals to a VCD file",
 }.Register()
 
+// TestTimeout kills simulations that run longer than the given number of seconds
+var TestTimeout = core.IntFlag{
+	Name: "hdl-test-timeout",
+	DefaultFn: func() int64 {
+		return 0
+	},
+	Description: "Kill HDL test simulations running longer than this many seconds, 0 disables the timeout",
+}.Register()
+
 type ParamMap map[string]map[string]string
 type DefineMap map[string]string
 
+// ParamKind is the type of a generic, which decides how its value is quoted for the simulators.
+type ParamKind string
+
+const (
+	ParamString ParamKind = "string"
+	ParamInt    ParamKind = "int"
+	ParamReal   ParamKind = "real"
+)
+
 type Simulation struct {
 	Name                   string
 	Srcs                   []core.Path
@@ -90,6 +127,27 @@ type Simulation struct {
 	TestCasesDir           core.Path
 	WaveformInit           core.Path
 	ReportCovIps           []Ip
+
+	// LanguageOrder makes xsim analyze all sources of one language before the other
+	// ("vhdl-first" or "verilog-first"), keeping the order within each language. By
+	// default, sources are analyzed in the order they are listed.
+	LanguageOrder string
+
+	// Timeout kills a test simulation that runs longer than this, which then fails. It
+	// overrides the hdl-test-timeout flag.
+	Timeout time.Duration
+
+	// ParamKinds declares the kind of generics in Params by name, to quote their values
+	// correctly. Generics without a kind are passed as bare tokens.
+	ParamKinds map[string]ParamKind
+
+	// WaveformInits are sourced in order after WaveformInit in GUI mode, to layer several
+	// waveform configurations.
+	WaveformInits []core.Path
+
+	// StartupTcl is sourced once the design is loaded, before the simulation runs, in both
+	// GUI and batch mode, e.g. for force statements or register initialization.
+	StartupTcl core.Path
 }
 
 // Lib returns the standard library name defined for this rule.
@@ -97,6 +155,61 @@ func (rule Simulation) Lib() string {
 	return rule.Name + "_lib"
 }
 
+// Instance returns the hierarchical path of the design under test, which scopes the code
+// coverage report of the design under test written by Questa. Top and Dut default to the hdl-default-top and hdl-default-dut
+// flags, and the first of Tops is used if there are several top-level units.
+func (rule Simulation) Instance() string {
+	top := DefaultTop.Value()
+	if rule.Top != "" {
+		top = rule.Top
+	} else if len(rule.Tops) > 0 {
+		top = rule.Tops[0]
+	}
+
+	dut := DefaultDut.Value()
+	if rule.Dut != "" {
+		dut = rule.Dut
+	}
+
+	return "/" + top + "/" + dut
+}
+
+// waveformInits returns the waveform configurations to source in GUI mode, in order.
+func (rule Simulation) waveformInits() []core.Path {
+	inits := []core.Path{}
+	if rule.WaveformInit != nil {
+		inits = append(inits, rule.WaveformInit)
+	}
+	return append(inits, rule.WaveformInits...)
+}
+
+// timeoutPrefix returns the command prefix that kills a test simulation once its timeout
+// has expired, or an empty string if there is no timeout.
+func (rule Simulation) timeoutPrefix() string {
+	seconds := TestTimeout.Value()
+	if rule.Timeout != 0 {
+		seconds = int64(rule.Timeout.Seconds())
+	}
+	if seconds <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("timeout -k 10 %d ", seconds)
+}
+
+// paramValue returns the value of a generic as passed on the simulator command line. String
+// values are wrapped in escaped quotes, other values are passed as bare tokens.
+func (rule Simulation) paramValue(name, value string) string {
+	switch rule.ParamKinds[name] {
+	case ParamString:
+		return `\"` + value + `\"`
+	case "", ParamInt, ParamReal:
+		return value
+	default:
+		log.Fatal(fmt.Sprintf("invalid kind '%s' for parameter '%s'", rule.ParamKinds[name], name))
+	}
+	return ""
+}
+
 // Path returns the default root path for log files defined for this rule.
 func (rule Simulation) Path() core.Path {
 	return core.BuildPath("/" + rule.Name)
@@ -144,6 +257,63 @@ func (rule Simulation) Target(params string, coverage bool) string {
 	return target
 }
 
+// testCombinations returns the parameter sets and testcases to simulate, as selected by
+// the -params= and -testcases= arguments. All parameter sets and all testcases in
+// TestCasesDir are selected if none are specified. An empty string stands for the
+// default parameter set or testcase.
+func (rule Simulation) testCombinations(args []string) ([]string, []string) {
+	// Optional testcase goes here
+	testcases := []string{}
+
+	// Optional parameter set goes here
+	params := []string{}
+
+	// Parse additional arguments
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-testcases=") && rule.TestCaseGenerator != nil {
+			var testcases_arg string
+			if _, err := fmt.Sscanf(arg, "-testcases=%s", &testcases_arg); err != nil {
+				log.Fatal(fmt.Sprintf("-testcases expects a string argument!"))
+			}
+			testcases = append(testcases, strings.Split(testcases_arg, ",")...)
+		} else if strings.HasPrefix(arg, "-params=") && rule.Params != nil {
+			var params_arg string
+			if _, err := fmt.Sscanf(arg, "-params=%s", &params_arg); err != nil {
+				log.Fatal(fmt.Sprintf("-params expects a string argument!"))
+			} else {
+				for _, param := range strings.Split(params_arg, ",") {
+					if _, ok := rule.Params[param]; ok {
+						params = append(params, param)
+					}
+				}
+			}
+		}
+	}
+
+	// If no parameters have been specified, simulate them all
+	if rule.Params != nil && len(params) == 0 {
+		params = append(params, rule.SortedParams()...)
+	} else if len(params) == 0 {
+		params = append(params, "")
+	}
+
+	// If no testcase has been specified, simulate them all
+	if rule.TestCaseGenerator != nil && rule.TestCasesDir != nil && len(testcases) == 0 {
+		// Loop through all defined testcases in directory
+		if items, err := os.ReadDir(rule.TestCasesDir.String()); err == nil {
+			for _, item := range items {
+				testcases = append(testcases, item.Name())
+			}
+		} else {
+			log.Fatal(err)
+		}
+	} else if len(testcases) == 0 {
+		testcases = append(testcases, "")
+	}
+
+	return params, testcases
+}
+
 func (rule Simulation) Build(ctx core.Context) {
 	switch Simulator.Value() {
 	case "xsim":
@@ -154,6 +324,10 @@ func (rule Simulation) Build(ctx core.Context) {
 		log.Fatal(fmt.Sprintf("invalid value '%s' for hdl-simulator flag", Simulator.Value()))
 	}
 	rule.CopyBinaries(ctx)
+
+	if shardedTests() {
+		ctx.BuildChild(testShards{rule})
+	}
 }
 
 func (rule Simulation) Run(args []string) string {
@@ -172,6 +346,10 @@ func (rule Simulation) Run(args []string) string {
 }
 
 func (rule Simulation) Test(args []string) string {
+	if shardedTests() {
+		return testShards{rule}.testCmd()
+	}
+
 	res := ""
 	switch Simulator.Value() {
 	case "xsim":
@@ -185,6 +363,14 @@ func (rule Simulation) Test(args []string) string {
 	return res
 }
 
+// TestDeps returns the summary and reports of the test shards, if tests are sharded.
+func (rule Simulation) TestDeps() []core.Path {
+	if !shardedTests() {
+		return []core.Path{}
+	}
+	return testShards{rule}.outputs()
+}
+
 func (rule Simulation) Description() string {
 	// Print the rule name as its needed for parameter selection
 	description := ""
@@ -259,6 +445,39 @@ func (rule Simulation) Description() string {
 	return description
 }
 
+// CoverageData returns the coverage data written by the tests of the simulation with the
+// coverage flag set, for merging it into a core.CoverageReport.
+func (rule Simulation) CoverageData() []core.OutPath {
+	switch Simulator.Value() {
+	case "xsim":
+		return []core.OutPath{xsimCoverageDir(rule)}
+	case "questa":
+		return []core.OutPath{questaCoverageDb(rule)}
+	default:
+		log.Fatal(fmt.Sprintf("coverage not supported for hdl-simulator flag '%s'", Simulator.Value()))
+	}
+	return nil
+}
+
+// CoverageTool returns the simulator writing the coverage data.
+func (rule Simulation) CoverageTool() string {
+	return Simulator.Value()
+}
+
+// CoverageReportCmd returns a command merging the coverage data of simulations and writing
+// an HTML report into dir.
+func (rule Simulation) CoverageReportCmd(data []core.OutPath, dir core.OutPath) string {
+	switch Simulator.Value() {
+	case "xsim":
+		return xsimCoverageReportCmd(data, dir)
+	case "questa":
+		return questaCoverageReportCmd(data, dir)
+	default:
+		log.Fatal(fmt.Sprintf("coverage not supported for hdl-simulator flag '%s'", Simulator.Value()))
+	}
+	return ""
+}
+
 func (rule Simulation) ReportCovFiles() []string {
 	files := []string{}
 
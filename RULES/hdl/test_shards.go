@@ -0,0 +1,233 @@
+package hdl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dbt-rules/RULES/core"
+)
+
+// TestShards enables running every parameter set and testcase of a simulation test as
+// a separate build step, so that ninja can run them in parallel.
+var TestShards = core.BoolFlag{
+	Name: "hdl-test-shards",
+	DefaultFn: func() bool {
+		return false
+	},
+	Description: "Run each parameter set and testcase of HDL tests as a separate build step",
+}.Register()
+
+// TestJunit enables writing the results of sharded simulation tests as JUnit XML.
+var TestJunit = core.BoolFlag{
+	Name: "hdl-test-junit",
+	DefaultFn: func() bool {
+		return false
+	},
+	Description: "Write the results of HDL tests to a JUnit XML file, implies hdl-test-shards",
+}.Register()
+
+// shardedTests reports whether simulation tests are run as separate build steps.
+func shardedTests() bool {
+	return TestShards.Value() || TestJunit.Value()
+}
+
+// testShards creates one build step per parameter set and testcase of a Simulation,
+// plus a summary of their results. The steps are only run when testing the simulation.
+type testShards struct {
+	rule Simulation
+}
+
+// name returns the name of the shard for the given parameter set and testcase.
+func (shards testShards) name(params string, testcase string) string {
+	parts := []string{}
+	if params != "" {
+		parts = append(parts, params)
+	}
+	if testcase != "" {
+		parts = append(parts, strings.TrimSuffix(testcase, ".json"))
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, "_")
+}
+
+// result returns the file holding the output of a shard, followed by a line with its
+// duration in seconds and a final PASS or FAIL line.
+func (shards testShards) result(params string, testcase string) core.OutPath {
+	return shards.rule.Path().WithSuffix("/shards/" + shards.name(params, testcase) + ".result")
+}
+
+func (shards testShards) summary() core.OutPath {
+	return shards.rule.Path().WithSuffix("/shards/summary.txt")
+}
+
+func (shards testShards) junit() core.OutPath {
+	return shards.rule.Path().WithSuffix("/shards/results.xml")
+}
+
+// outputs returns the files the test command depends on.
+func (shards testShards) outputs() []core.Path {
+	outputs := []core.Path{shards.summary()}
+	if TestJunit.Value() {
+		outputs = append(outputs, shards.junit())
+	}
+	return outputs
+}
+
+// results returns the result files of all shards selected by the test arguments.
+func (shards testShards) results() []core.Path {
+	results := []core.Path{}
+	params, testcases := shards.rule.testCombinations(core.TestArgs())
+	for _, p := range params {
+		for _, testcase := range testcases {
+			results = append(results, shards.result(p, testcase))
+		}
+	}
+	return results
+}
+
+// simulationInputs returns the outputs of the simulation build a shard with the given
+// parameter set depends on.
+func (shards testShards) simulationInputs(params string) []core.Path {
+	prefix := ""
+	if params != "" {
+		prefix = params + "_"
+	}
+
+	switch Simulator.Value() {
+	case "xsim":
+		return []core.Path{
+			shards.rule.Path().WithSuffix("/" + prefix + "xelab.log"),
+			shards.rule.Path().WithSuffix("/xsim.tcl"),
+		}
+	case "questa":
+		return []core.Path{
+			shards.rule.Path().WithSuffix("/" + prefix + "vopt.log"),
+			shards.rule.Path().WithSuffix("/vsim.do"),
+		}
+	default:
+		log.Fatal(fmt.Sprintf("'test' target not supported for hdl-simulator flag '%s'", Simulator.Value()))
+	}
+	return nil
+}
+
+func (shards testShards) simCmd(args []string, testcase string, params string) string {
+	switch Simulator.Value() {
+	case "xsim":
+		return xsimCmd(shards.rule, args, false, testcase, params)
+	case "questa":
+		return vsimCmd(shards.rule, args, false, testcase, params)
+	default:
+		log.Fatal(fmt.Sprintf("'test' target not supported for hdl-simulator flag '%s'", Simulator.Value()))
+	}
+	return ""
+}
+
+func (shards testShards) Build(ctx core.Context) {
+	// Testcases share the TestCaseElf generated for them and coverage databases are
+	// merged in place, so such shards are still run one after another.
+	var pool *core.Pool
+	if shards.rule.TestCaseGenerator != nil || Coverage.Value() {
+		pool = &core.Pool{Name: shards.rule.Target("", false) + "_shards", Depth: 1}
+	}
+
+	args := core.TestArgs()
+	params, testcases := shards.rule.testCombinations(args)
+	for _, p := range params {
+		for _, testcase := range testcases {
+			result := shards.result(p, testcase)
+			ctx.AddBuildStep(core.BuildStep{
+				Out: result,
+				Ins: shards.simulationInputs(p),
+				Cmd: fmt.Sprintf("start=$$(date +%%s); if %s > %s 2>&1; then status=PASS; else status=FAIL; fi; "+
+					"echo \"time: $$(($$(date +%%s) - start))\" >> %s; echo $$status >> %s",
+					shards.simCmd(args, testcase, p), result, result, result),
+				Descr: fmt.Sprintf("test: %s %s", shards.rule.Name, shards.name(p, testcase)),
+				Phony: true,
+				Pool:  pool,
+			})
+		}
+	}
+
+	summary := shards.summary()
+	ctx.AddBuildStep(core.BuildStep{
+		Out: summary,
+		Ins: shards.results(),
+		Cmd: fmt.Sprintf("{ for f in %s; do echo \"$$(basename $$f .result): $$(tail -n 1 $$f)\"; done; } > %s.tmp && "+
+			"{ cat %s.tmp; echo \"Passed: $$(grep -c ': PASS$$' %s.tmp), Failed: $$(grep -c ': FAIL$$' %s.tmp)\"; } > %s && rm %s.tmp",
+			joinPaths(shards.results()), summary, summary, summary, summary, summary, summary),
+		Descr: fmt.Sprintf("test summary: %s", shards.rule.Name),
+	})
+
+	if TestJunit.Value() {
+		junit := shards.junit()
+		ctx.AddBuildStep(core.BuildStep{
+			Out:    junit,
+			Ins:    shards.results(),
+			Script: core.CompileTemplate(junit_script_template, "junit", shards.junitParams()),
+			Descr:  fmt.Sprintf("test junit: %s", junit.Relative()),
+		})
+	}
+}
+
+type junitParams struct {
+	Name    string
+	Out     string
+	Results []string
+}
+
+func (shards testShards) junitParams() junitParams {
+	params := junitParams{
+		Name: shards.rule.Name,
+		Out:  shards.junit().String(),
+	}
+	for _, result := range shards.results() {
+		params.Results = append(params.Results, result.String())
+	}
+	return params
+}
+
+// junit_script_template converts the shard results into a JUnit XML test suite. The
+// output of each shard is kept as the system-out of its testcase.
+const junit_script_template = `#!/bin/sh
+results="{{ range .Results }} {{ . }}{{ end }}"
+tests=0
+failures=0
+for f in $results; do
+  tests=$((tests + 1))
+  [ "$(tail -n 1 "$f")" = PASS ] || failures=$((failures + 1))
+done
+{
+  echo '<?xml version="1.0" encoding="UTF-8"?>'
+  echo "<testsuite name=\"{{ .Name }}\" tests=\"$tests\" failures=\"$failures\">"
+  for f in $results; do
+    name=$(basename "$f" .result)
+    time=$(tail -n 2 "$f" | head -n 1 | sed 's/^time: //')
+    echo "  <testcase classname=\"{{ .Name }}\" name=\"$name\" time=\"$time\">"
+    [ "$(tail -n 1 "$f")" = PASS ] || echo '    <failure message="FAIL"/>'
+    echo '    <system-out><![CDATA['
+    head -n -2 "$f" | sed 's/]]>/]]]]><![CDATA[>/g'
+    echo '    ]]></system-out>'
+    echo '  </testcase>'
+  done
+  echo '</testsuite>'
+} > {{ .Out }}
+`
+
+// testCmd prints the summary of all shards and the output of the failed ones.
+func (shards testShards) testCmd() string {
+	summary := shards.summary()
+	return fmt.Sprintf("cat %s && ! grep -q ': FAIL$$' %s || "+
+		"{ for f in %s; do tail -n 1 $$f | grep -q '^FAIL$$' && cat $$f; done; exit 1; }",
+		summary, summary, joinPaths(shards.results()))
+}
+
+func joinPaths(paths []core.Path) string {
+	strs := []string{}
+	for _, p := range paths {
+		strs = append(strs, p.String())
+	}
+	return strings.Join(strs, " ")
+}
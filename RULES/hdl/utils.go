@@ -5,6 +5,8 @@ import (
 	"strings"
 )
 
+// IsRtl returns true for HDL sources. Encrypted sources (using `pragma protect`) are RTL too
+// and are passed to the simulator unchanged, which decrypts them.
 func IsRtl(path string) bool {
 	return strings.HasSuffix(path, ".v") ||
 		strings.HasSuffix(path, ".sv") ||
@@ -36,14 +38,28 @@ func IsConstraint(path string) bool {
 	return strings.HasSuffix(path, ".xdc")
 }
 
+// IsXilinxIpCheckpoint returns true for IP configuration files and for IP containers.
 func IsXilinxIpCheckpoint(path string) bool {
-	return strings.HasSuffix(path, ".xci")
+	return strings.HasSuffix(path, ".xci") ||
+		IsXilinxIpContainer(path)
+}
+
+// IsXilinxIpContainer returns true for IP containers, which are archives holding the IP
+// configuration file along with its generated outputs.
+func IsXilinxIpContainer(path string) bool {
+	return strings.HasSuffix(path, ".xcix")
 }
 
 func IsSimulationArchive(path string) bool {
 	return strings.HasSuffix(path, ".sim.tar.gz")
 }
 
+// IsSimulationLibraryArchive returns true for archives of compiled simulation libraries,
+// as created by SimulationArchive.
+func IsSimulationLibraryArchive(path string) bool {
+	return strings.HasSuffix(path, ".simlib.tar.gz")
+}
+
 func sortedStringKeys(m map[string]string) []string {
 	keys := make([]string, len(m))
 	i := 0
@@ -1,6 +1,8 @@
 package hdl
 
 import (
+	"archive/zip"
+	"crypto/sha256"
 	"dbt-rules/RULES/core"
 	"encoding/json"
 	"fmt"
@@ -55,6 +57,10 @@ type Xci struct {
 func ReadXci(path string) (Xci, error) {
 	var result Xci
 
+	if IsXilinxIpContainer(path) {
+		return readXcix(path)
+	}
+
 	xci_file, err := os.Open(path)
 	if err == nil {
 		// defer the closing of the file
@@ -68,6 +74,36 @@ func ReadXci(path string) (Xci, error) {
 	return result, err
 }
 
+// readXcix reads the XCI file stored in an IP container.
+func readXcix(path string) (Xci, error) {
+	var result Xci
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return result, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".xci") {
+			continue
+		}
+
+		xci_file, err := file.Open()
+		if err != nil {
+			return result, err
+		}
+		defer xci_file.Close()
+
+		bytes, _ := ioutil.ReadAll(xci_file)
+
+		err = json.Unmarshal([]byte(bytes), &result)
+		return result, err
+	}
+
+	return result, fmt.Errorf("no XCI file found in %s", path)
+}
+
 type exportTemplateParams struct {
 	Sources   []core.Path
 	Simulator string
@@ -83,10 +119,10 @@ type exportTemplateParams struct {
 
 const export_ip_template = `
 {{- range .Sources }}
-{{- if or (hasSuffix .String ".xci") }}
+{{- if or (hasSuffix .String ".xci") (hasSuffix .String ".xcix") }}
 if {[file exists .srcs] && [file isdirectory .srcs]} {
   set name [file tail {{ .String }}]
-  foreach xci [exec find .srcs -name "*.xci"] {
+  foreach xci [exec find .srcs -name "*.xci" -o -name "*.xcix"] {
     if {[file tail $xci] == $name} {
       puts "Removing existing IP in $xci"
       file delete -force $xci
@@ -188,6 +224,18 @@ foreach f [get_files -of [get_filesets utils_1]] {
 }
 `
 
+// ipIdentity returns what identifies the IP generated from an XCI file: its name, component,
+// revision and a hash of its parameters. Changes to an XCI file that leave the identity
+// untouched, e.g. in formatting, do not change the generated IP.
+func ipIdentity(xci Xci) string {
+	params, err := json.Marshal(xci.IpInst.Parameters)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("unable to serialize the parameters of IP %s: %s", xci.IpInst.XciName, err))
+	}
+	return fmt.Sprintf("name: %s\ncomponent: %s\nrevision: %s\nparameters: %x\n",
+		xci.IpInst.XciName, xci.IpInst.ComponentReference, xci.IpInst.IpRevision, sha256.Sum256(params))
+}
+
 func ExportXilinxIpCheckpoint(ctx core.Context, rule Simulation, src core.Path, def DefineMap, flags FlagMap) core.Path {
 	xci, err := ReadXci(src.String())
 	if err != nil {
@@ -226,6 +274,16 @@ func ExportXilinxIpCheckpoint(ctx core.Context, rule Simulation, src core.Path,
 	dir := core.BuildPath(path.Dir(src.Relative()))
 	do := core.BuildPath(newRel).WithSuffix(fmt.Sprintf("/%s/compile.do", Simulator.Value()))
 
+	// The export depends on the identity of the IP rather than on the XCI file itself. The
+	// identity file is only touched when its content changes, so that changes to the XCI file
+	// which do not affect the IP do not trigger a new export.
+	identity := core.BuildPath(newRel).WithSuffix(".ip-identity")
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   identity,
+		Data:  ipIdentity(xci),
+		Descr: fmt.Sprintf("ip identity: %s", src.Relative()),
+	})
+
 	// Template parameters are the direct and parent script sources.
 	data := exportTemplateParams{
 		Sources:   []core.Path{src},
@@ -237,9 +295,16 @@ func ExportXilinxIpCheckpoint(ctx core.Context, rule Simulation, src core.Path,
 		Options:   options,
 	}
 
+	// Generated XCI files are read when generating the build files, possibly before the
+	// step generating them ran again, so the export also depends on them directly.
+	ins := []core.Path{identity}
+	if _, ok := src.(core.OutPath); ok {
+		ins = append(ins, src)
+	}
+
 	ctx.AddBuildStep(core.BuildStep{
 		Out:    do,
-		In:     src,
+		Ins:    ins,
 		Script: core.CompileTemplate(vivado_command+create_project_template+export_ip_template, "export_ip", data),
 		Descr:  fmt.Sprintf("export: %s", src.Relative()),
 	})
@@ -386,7 +451,7 @@ add_files -norecurse {
 catch {
   import_ip {
 {{- range .Sources }}
-  {{- if hasSuffix .String ".xci"}}
+  {{- if or (hasSuffix .String ".xci") (hasSuffix .String ".xcix") }}
     {{ . }}
   {{- end }}
 {{- end }}
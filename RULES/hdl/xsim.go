@@ -3,7 +3,6 @@ package hdl
 import (
 	"fmt"
 	"log"
-	"os"
 	"path"
 	"strings"
 
@@ -48,6 +47,15 @@ var XsimFlags = core.StringFlag{
 	Description: "Extra flags for the xsim command",
 }.Register()
 
+// XsimHeaderDepfile makes xelab steps depend on the headers in the include directories.
+var XsimHeaderDepfile = core.BoolFlag{
+	Name: "xsim-header-depfile",
+	DefaultFn: func() bool {
+		return true
+	},
+	Description: "Track the headers in the include directories of xsim simulations with a depfile",
+}.Register()
+
 // xsim_rules holds a map of all defined rules to prevent defining the same rule
 // multiple times.
 var xsim_rules map[string]bool
@@ -87,6 +95,7 @@ close_vcd
 
 type prjFile struct {
 	Rule   Simulation
+	Lib    string
 	Macros []string
 	Incs   []string
 	Deps   []core.Path
@@ -95,11 +104,17 @@ type prjFile struct {
 
 func addToPrjFile(ctx core.Context, prj prjFile, ips []Ip, srcs []core.Path) prjFile {
 	for _, ip := range ips {
+		// Compile the IP into its own library, if it has one
+		lib := prj.Lib
+		prj.Lib = strings.ToLower(ipSimLibrary(ip, lib))
 		prj = addToPrjFile(ctx, prj, ip.Ips(), ip.Sources())
+		prj.Lib = lib
 	}
 
 	for _, src := range srcs {
-		if IsHeader(src.String()) {
+		if IsSimulationLibraryArchive(src.String()) {
+			log.Fatal(fmt.Sprintf("simulation library archive %s: library archives are only supported by Questa", src.Relative()))
+		} else if IsHeader(src.String()) {
 			new_path := path.Dir(src.Absolute())
 			if !xsim_rules[new_path] {
 				prj.Incs = append(prj.Incs, new_path)
@@ -119,7 +134,7 @@ func addToPrjFile(ctx core.Context, prj prjFile, ips []Ip, srcs []core.Path) prj
 				prefix = "vhdl"
 			}
 
-			entry := fmt.Sprintf("%s %s %s", prefix, strings.ToLower(prj.Rule.Lib()), src.String())
+			entry := fmt.Sprintf("%s %s %s", prefix, prj.Lib, src.String())
 
 			for _, inc_path := range prj.Incs {
 				entry = entry + " -i " + inc_path
@@ -140,7 +155,35 @@ func addToPrjFile(ctx core.Context, prj prjFile, ips []Ip, srcs []core.Path) prj
 	return prj
 }
 
-func createPrjFile(ctx core.Context, rule Simulation) core.Path {
+// orderByLanguage reorders the project file entries according to the LanguageOrder
+// of the rule, keeping the order of the entries within each language.
+func orderByLanguage(rule Simulation, entries []string) []string {
+	if rule.LanguageOrder == "" {
+		return entries
+	}
+
+	vhdl := []string{}
+	verilog := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "vhdl ") {
+			vhdl = append(vhdl, entry)
+		} else {
+			verilog = append(verilog, entry)
+		}
+	}
+
+	switch rule.LanguageOrder {
+	case "vhdl-first":
+		return append(vhdl, verilog...)
+	case "verilog-first":
+		return append(verilog, vhdl...)
+	default:
+		log.Fatal(fmt.Sprintf("invalid LanguageOrder '%s' for Simulation target '%s'!", rule.LanguageOrder, rule.Name))
+	}
+	return entries
+}
+
+func createPrjFile(ctx core.Context, rule Simulation) (core.Path, prjFile) {
 	// Clear the rules map
 	xsim_rules = make(map[string]bool)
 
@@ -159,9 +202,11 @@ func createPrjFile(ctx core.Context, rule Simulation) core.Path {
 		ctx,
 		prjFile{
 			Rule:   rule,
+			Lib:    strings.ToLower(rule.Lib()),
 			Macros: macros,
 			Incs:   []string{core.SourcePath("").String()},
 		}, rule.Ips, rule.Srcs)
+	prjFileContents.Data = orderByLanguage(rule, prjFileContents.Data)
 	ctx.AddBuildStep(core.BuildStep{
 		Out:   prjFilePath,
 		Ins:   prjFileContents.Deps,
@@ -169,7 +214,15 @@ func createPrjFile(ctx core.Context, rule Simulation) core.Path {
 		Descr: fmt.Sprintf("xsim project: %s", prjFilePath.Relative()),
 	})
 
-	return prjFilePath
+	return prjFilePath, prjFileContents
+}
+
+// headerDepfileCmd creates a command writing a depfile for the given output, which lists
+// the headers in the include directories. xelab does not report the headers it reads, so
+// all headers that it may read are listed instead.
+func headerDepfileCmd(out core.OutPath, depfile core.OutPath, incs []string) string {
+	return fmt.Sprintf("{ printf '%%s:' %s; find %s -maxdepth 1 -type f \\( -name '*.vh' -o -name '*.svh' -o -name '*.svp' \\) -printf ' %%p' 2> /dev/null; echo; } > %s",
+		out.String(), strings.Join(incs, " "), depfile.String())
 }
 
 // Create a simulation script
@@ -189,10 +242,49 @@ func tclFile(ctx core.Context, rule Simulation) {
 	})
 }
 
+// xsimCoverageDir returns the directory holding the coverage databases of a simulation.
+func xsimCoverageDir(rule Simulation) core.OutPath {
+	return rule.Path().WithSuffix("/coverage")
+}
+
+// xcrgCmd creates a command for writing the HTML coverage report of a simulation run, which
+// recorded its functional coverage in the database cov_db and its code coverage in the
+// database of the snapshot.
+func xcrgCmd(rule Simulation, snapshot string, cov_db string) string {
+	types := coverageTypes()
+	dir := xsimCoverageDir(rule).String()
+	xcrg_cmd := []string{"xcrg", "-report_format", "html"}
+	if types["cvg"] || types["assert"] {
+		xcrg_cmd = append(xcrg_cmd, "-dir", dir, "-db_name", cov_db)
+	}
+	if types["code"] {
+		xcrg_cmd = append(xcrg_cmd, "-cc_dir", dir, "-cc_db", snapshot)
+	}
+	xcrg_cmd = append(xcrg_cmd, "-report_dir", rule.Path().WithSuffix("/coverage_report/"+cov_db).String())
+	return strings.Join(xcrg_cmd, " ") + " > /dev/null"
+}
+
+// xsimCoverageReportCmd creates a command merging the coverage databases in the coverage
+// directories of simulations with xcrg and writing an HTML report into dir.
+func xsimCoverageReportCmd(data []core.OutPath, dir core.OutPath) string {
+	types := coverageTypes()
+	xcrg_cmd := []string{"xcrg", "-report_format", "html"}
+	for _, cov_dir := range data {
+		if types["cvg"] || types["assert"] {
+			xcrg_cmd = append(xcrg_cmd, "-dir", cov_dir.String())
+		}
+		if types["code"] {
+			xcrg_cmd = append(xcrg_cmd, "-cc_dir", cov_dir.String())
+		}
+	}
+	xcrg_cmd = append(xcrg_cmd, "-report_dir", dir.String())
+	return strings.Join(xcrg_cmd, " ") + " > /dev/null"
+}
+
 // elaborate creates and optimized version of the design optionally including
 // coverage recording functionality. The optimized design unit can then conveniently
 // be simulated using 'xsim'.
-func elaborate(ctx core.Context, rule Simulation, prj_file core.Path) {
+func elaborate(ctx core.Context, rule Simulation, prj_file core.Path, prj prjFile) {
 	xelab_base_cmd := []string{
 		"xelab",
 		"--timescale",
@@ -206,7 +298,11 @@ func elaborate(ctx core.Context, rule Simulation, prj_file core.Path) {
 		xelab_base_cmd = append(xelab_base_cmd, "--lib", lib)
 	}
 
-	tops := []string{"board"}
+	for _, lib := range ipSimLibraries(rule.Ips) {
+		xelab_base_cmd = append(xelab_base_cmd, "--lib", strings.ToLower(lib))
+	}
+
+	tops := []string{DefaultTop.Value()}
 	if rule.Top != "" {
 		tops = []string{rule.Top}
 	} else if len(rule.Tops) > 0 {
@@ -241,13 +337,18 @@ func elaborate(ctx core.Context, rule Simulation, prj_file core.Path) {
 		// Build up command using base command plus additional variable arguments
 		xelab_cmd := append(xelab_base_cmd, "--log", log_file.String(), "--snapshot", target)
 
+		// Record code coverage into a database named after the snapshot
+		if Coverage.Value() && coverageTypes()["code"] {
+			xelab_cmd = append(xelab_cmd, "--cc_type", "sbct", "--cc_dir", xsimCoverageDir(rule).String(), "--cc_db", target)
+		}
+
 		// Set up parameters
 		if param_set != "" {
 			// Check that the parameters exist
 			if params, ok := rule.Params[param_set]; ok {
 				// Add parameters for all generics
 				for param, value := range params {
-					xelab_cmd = append(xelab_cmd, "-generic_top", fmt.Sprintf("\"%s=%s\"", param, value))
+					xelab_cmd = append(xelab_cmd, "-generic_top", fmt.Sprintf("\"%s=%s\"", param, rule.paramValue(param, value)))
 				}
 			} else {
 				log.Fatal(fmt.Sprintf("parameter set '%s' not defined for Simulation target '%s'!",
@@ -258,18 +359,28 @@ func elaborate(ctx core.Context, rule Simulation, prj_file core.Path) {
 		cmd := strings.Join(xelab_cmd, " ") + " > /dev/null || { cat " + log_file.String() +
 			"; rm " + log_file.String() + "; exit 1; }"
 
+		var depfile core.OutPath
+		if XsimHeaderDepfile.Value() {
+			depfile = log_file.WithSuffix(".d")
+			cmd = "{ " + cmd + "; } && " + headerDepfileCmd(log_file, depfile, prj.Incs)
+		}
+
+		// The project file is only updated when its contents change, so depend on the
+		// sources directly to elaborate again when they change.
+		deps := append([]core.Path{prj_file}, prj.Deps...)
+
 		// Hack: Add testcase generator as an optional dependency
-		deps := []core.Path{prj_file}
 		if rule.TestCaseGenerator != nil {
 			deps = append(deps, rule.TestCaseGenerator)
 		}
 
 		// Add the rule to run 'xelab'.
 		ctx.AddBuildStep(core.BuildStep{
-			Out:   log_file,
-			Ins:   deps,
-			Cmd:   cmd,
-			Descr: fmt.Sprintf("xelab: %s %s", strings.Join(tops, " "), target),
+			Out:     log_file,
+			Ins:     deps,
+			Cmd:     cmd,
+			Depfile: depfile,
+			Descr:   fmt.Sprintf("xelab: %s %s", strings.Join(tops, " "), target),
 		})
 	}
 }
@@ -277,10 +388,10 @@ func elaborate(ctx core.Context, rule Simulation, prj_file core.Path) {
 // BuildXsim will compile and elaborate the source and IPs associated with the given
 // rule.
 func BuildXsim(ctx core.Context, rule Simulation) {
-	prj := createPrjFile(ctx, rule)
+	prj_file, prj := createPrjFile(ctx, rule)
 
 	// compile and elaborate the code
-	elaborate(ctx, rule, prj)
+	elaborate(ctx, rule, prj_file, prj)
 
 	// Create simulation script
 	tclFile(ctx, rule)
@@ -344,11 +455,20 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 
 	// Default flag values
 	seed := int64(1)
+	xsim := "xsim"
+	if !gui {
+		// A simulation killed on timeout fails like any other failing simulation
+		xsim = rule.timeoutPrefix() + xsim
+	}
 	xsim_cmd := []string{
-		"xsim",
-		"--log", log_file.String(),
+		xsim,
+		"--log", log_file.String()}
+	if rule.StartupTcl != nil {
+		xsim_cmd = append(xsim_cmd, "--tclbatch", rule.StartupTcl.String())
+	}
+	xsim_cmd = append(xsim_cmd,
 		"--tclbatch", do_file.String(),
-		XsimFlags.Value()}
+		XsimFlags.Value())
 	verbosity_level := "none"
 
 	// Parse additional arguments
@@ -422,6 +542,20 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 		}
 	}
 
+	//Finally, add the snapshot to the command as the last element
+	snapshot := rule.Name
+	if params != "" {
+		snapshot = snapshot + "_" + params
+	}
+
+	// Record functional coverage into a database per run and report it after the run
+	cmd_report := ""
+	if Coverage.Value() && !gui {
+		cov_db := rule.Name + "_" + testcase
+		xsim_cmd = append(xsim_cmd, "--cov_db_dir", xsimCoverageDir(rule).String(), "--cov_db_name", cov_db)
+		cmd_report = " && " + xcrgCmd(rule, snapshot, cov_db)
+	}
+
 	// Optionally specify waveform data file
 	if gui || XsimDumpWdb.Value() {
 		xsim_cmd = append(xsim_cmd, "--wdb", wdb_file.String())
@@ -430,8 +564,10 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 	cmd_postamble := ""
 	if gui {
 		xsim_cmd = append(xsim_cmd, "--gui")
-		if rule.WaveformInit != nil && strings.HasSuffix(rule.WaveformInit.String(), ".tcl") {
-			xsim_cmd = append(xsim_cmd, "--tclbatch", rule.WaveformInit.String())
+		for _, init := range rule.waveformInits() {
+			if strings.HasSuffix(init.String(), ".tcl") {
+				xsim_cmd = append(xsim_cmd, "--tclbatch", init.String())
+			}
 		}
 	} else {
 		xsim_cmd = append(xsim_cmd, "--onfinish quit")
@@ -447,11 +583,6 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 	verbosity_flag, print_output := xsimVerbosityLevelToFlag(verbosity_level)
 	xsim_cmd = append(xsim_cmd, verbosity_flag)
 
-	//Finally, add the snapshot to the command as the last element
-	snapshot := rule.Name
-	if params != "" {
-		snapshot = snapshot + "_" + params
-	}
 	xsim_cmd = append(xsim_cmd, snapshot)
 
 	// Using this part of the command we send the stdout into a black hole to
@@ -461,9 +592,9 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 		cmd_devnull = "> /dev/null"
 	}
 
-	cmd := fmt.Sprintf("{ echo -n %s && %s %s && "+
+	cmd := fmt.Sprintf("{ echo -n %s && %s %s%s && "+
 		"{ { ! grep -q FAIL %s; } && echo PASS; } }",
-		cmd_echo, strings.Join(xsim_cmd, " "), cmd_devnull, log_file.String())
+		cmd_echo, strings.Join(xsim_cmd, " "), cmd_devnull, cmd_report, log_file.String())
 	if cmd_preamble == "" {
 		cmd = cmd + " " + cmd_postamble
 	} else {
@@ -481,56 +612,7 @@ func xsimCmd(rule Simulation, args []string, gui bool, testcase string, params s
 // optionally build a chain of commands in case the rule has parameters, but
 // no parameters are specified on the command line
 func simulateXsim(rule Simulation, args []string, gui bool) string {
-	// Optional testcase goes here
-	testcases := []string{}
-
-	// Optional parameter set goes here
-	params := []string{}
-
-	// Parse additional arguments
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "-testcases=") && rule.TestCaseGenerator != nil {
-			var testcases_arg string
-			if _, err := fmt.Sscanf(arg, "-testcases=%s", &testcases_arg); err != nil {
-				log.Fatal(fmt.Sprintf("-testcases expects a string argument!"))
-			}
-			testcases = append(testcases, strings.Split(testcases_arg, ",")...)
-		} else if strings.HasPrefix(arg, "-params=") && rule.Params != nil {
-			var params_arg string
-			if _, err := fmt.Sscanf(arg, "-params=%s", &params_arg); err != nil {
-				log.Fatal(fmt.Sprintf("-params expects a string argument!"))
-			} else {
-				for _, param := range strings.Split(params_arg, ",") {
-					if _, ok := rule.Params[param]; ok {
-						params = append(params, param)
-					}
-				}
-			}
-		}
-	}
-
-	// If no parameters have been specified, simulate them all
-	if rule.Params != nil && len(params) == 0 {
-		for key := range rule.Params {
-			params = append(params, key)
-		}
-	} else if len(params) == 0 {
-		params = append(params, "")
-	}
-
-	// If no testcase has been specified, simulate them all
-	if rule.TestCaseGenerator != nil && rule.TestCasesDir != nil && len(testcases) == 0 {
-		// Loop through all defined testcases in directory
-		if items, err := os.ReadDir(rule.TestCasesDir.String()); err == nil {
-			for _, item := range items {
-				testcases = append(testcases, item.Name())
-			}
-		} else {
-			log.Fatal(err)
-		}
-	} else if len(testcases) == 0 {
-		testcases = append(testcases, "")
-	}
+	params, testcases := rule.testCombinations(args)
 
 	// Final command
 	cmd := "{ :; }"
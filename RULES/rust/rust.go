@@ -33,6 +33,10 @@ func (bin Binary) BinLocation() core.OutPath {
 	return bin.Out.WithPrefix(fmt.Sprintf("%s/release/", filepath.Base(bin.Package.Relative())))
 }
 
+func (bin Binary) Output() core.OutPath {
+	return bin.BinLocation()
+}
+
 func (bin Binary) Build(ctx core.Context) {
 	if bin.Toolchain == "" {
 		bin.Toolchain = "stable"
@@ -2,6 +2,8 @@ package xilinx
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
 	"dbt-rules/RULES/core"
 	"dbt-rules/RULES/hdl"
@@ -21,27 +23,67 @@ var SynthFlattenStrategy = core.StringFlag{
 	AllowedValues: []string{"none", "rebuilt", "full"},
 }.Register()
 
+var BoardFiles = core.StringFlag{
+	Name:        "xilinx-board-files",
+	Description: "Space-separated list of board definition directories used by all xilinx rules, relative to the source directory unless absolute",
+	DefaultFn: func() string {
+		return ""
+	},
+}.Register()
+
+// boardFiles returns the board definition directories from the xilinx-board-files flag,
+// followed by the given per-rule directories.
+func boardFiles(ruleBoardFiles []core.Path) []string {
+	dirs := []string{}
+	for _, dir := range strings.Fields(BoardFiles.Value()) {
+		if path.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		} else {
+			dirs = append(dirs, core.SourcePath(dir).String())
+		}
+	}
+	for _, dir := range ruleBoardFiles {
+		dirs = append(dirs, dir.String())
+	}
+	return dirs
+}
+
+// tmpDirScript returns the start of a script working in the temporary directory dir in the
+// build tree (see core.Context.TempDir). The directory is created empty, and only removed by
+// the script on success, so that it is kept for inspection on failure.
+func tmpDirScript(dir core.OutPath) string {
+	return fmt.Sprintf(`TMPDIR=%s
+rm -rf ${TMPDIR} && mkdir -p ${TMPDIR}
+trap '[ $? -eq 0 ] || echo "Temporary directory kept for inspection: ${TMPDIR}" >&2' EXIT
+`, dir)
+}
+
 type BuildFileScriptParams struct {
 	Out             core.Path
 	PartName        string
 	BoardName       string
 	Name            string
 	IncDir          core.Path
-	BoardFiles      []core.Path
+	BoardFiles      []string
 	Ips             []core.Path
 	Constrs         []core.Path
 	Rtls            []core.Path
 	OutOfContext    bool
 	ReportDir       core.Path
 	FlattenStrategy string
+	IoReport        core.Path
 }
 
 type RunSynthesisScriptParams struct {
 	BuildScript core.Path
 	Bitstream   core.Path
 	DebugProbes core.Path
+	VivadoLog   core.Path
 	Verbose     bool
 	Postprocess string
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
 // Build a bitstream to program the FPGA
@@ -61,9 +103,22 @@ type Bitstream struct {
 	// Postprocessing algorithm; either "bin" (for loading with U-Boot) or ""
 	Postprocess string
 
-	// List of directories with board definitions
+	// List of directories with board definitions, in addition to the ones from the xilinx-board-files flag
 	BoardFiles []core.Path
 	Verbose    bool
+
+	// Write the IO placement report of the routed design, to verify the pin constraints
+	ReportIO bool
+}
+
+// VivadoLog returns the file holding the full Vivado output of the synthesis run.
+func (rule Bitstream) VivadoLog() core.OutPath {
+	return rule.Src.WithExt("bit").WithSuffix(".vivado.log")
+}
+
+// IoReport returns the IO placement report written when ReportIO is set.
+func (rule Bitstream) IoReport() core.OutPath {
+	return rule.Src.WithExt("io.rpt")
 }
 
 func (rule Bitstream) Build(ctx core.Context) {
@@ -89,6 +144,7 @@ func (rule Bitstream) Build(ctx core.Context) {
 	outBitstream := rule.Src.WithExt("bit")
 	outDebugProbes := rule.Src.WithExt("ltx")
 	outBf := rule.Src.WithExt("tcl")
+	outLog := rule.VivadoLog()
 
 	// Base directory for timestamped flow reports and checkpoints (PROJECT_ROOT/synth_reports/name)
 	outReportDir := core.SourcePath("../synth_reports/" + rule.Name)
@@ -105,7 +161,7 @@ func (rule Bitstream) Build(ctx core.Context) {
 		Name:            rule.Name,
 		PartName:        hdl.PartName.Value(),
 		BoardName:       hdl.BoardName.Value(),
-		BoardFiles:      rule.BoardFiles,
+		BoardFiles:      boardFiles(rule.BoardFiles),
 		IncDir:          core.SourcePath(""),
 		Ips:             ips,
 		Rtls:            rtls,
@@ -114,6 +170,9 @@ func (rule Bitstream) Build(ctx core.Context) {
 		ReportDir:       outReportDir,
 		FlattenStrategy: SynthFlattenStrategy.Value(),
 	}
+	if rule.ReportIO {
+		bfData.IoReport = rule.IoReport()
+	}
 
 	ctx.AddBuildStep(core.BuildStep{
 		Out:    outBf,
@@ -126,11 +185,16 @@ func (rule Bitstream) Build(ctx core.Context) {
 		BuildScript: outBf,
 		Bitstream:   outBitstream,
 		DebugProbes: outDebugProbes,
+		VivadoLog:   outLog,
 		Verbose:     rule.Verbose,
 		Postprocess: rule.Postprocess,
 	}
 
-	outs := []core.OutPath{outBitstream, outDebugProbes}
+	outs := []core.OutPath{outBitstream, outDebugProbes, outLog}
+	if rule.ReportIO {
+		outs = append(outs, rule.IoReport())
+	}
+	rsData.TmpDirScript = tmpDirScript(ctx.TempDir(outs...))
 	ctx.AddBuildStep(core.BuildStep{
 		Outs:   outs,
 		In:     outBf,
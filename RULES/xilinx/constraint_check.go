@@ -0,0 +1,146 @@
+package xilinx
+
+import (
+	"fmt"
+
+	"dbt-rules/RULES/core"
+	"dbt-rules/RULES/hdl"
+)
+
+func init() {
+	core.AssertIsBuildableTarget(&ConstraintCheck{})
+}
+
+type ConstraintCheckScriptParams struct {
+	Name         string
+	PartName     string
+	BoardFiles   []string
+	IncDir       core.Path
+	Rtls         []core.Path
+	Vhdls        []core.Path
+	Constrs      []core.Path
+	OutOfContext bool
+	Report       core.Path
+	VivadoLog    core.Path
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
+}
+
+var constraintCheckScript = `#!/bin/bash
+set -eu -o pipefail
+
+{{ .TmpDirScript }}
+(
+    cd ${TMPDIR}
+    cat > check_constraints.tcl <<EOF
+{{- range .BoardFiles }}
+set_param board.repoPaths [lappend board.repoPaths "{{ . }}"]
+{{- end }}
+
+create_project -in_memory -part "{{ .PartName }}"
+set_property "target_language" "Verilog" [current_project]
+{{ range .Vhdls }}
+read_vhdl "{{ . }}"
+{{- end }}
+{{- range .Rtls }}
+read_verilog -sv "{{ . }}"
+{{- end }}
+{{ range .Constrs }}
+read_xdc {{ if $.OutOfContext }}-mode out_of_context {{ end }}"{{ . }}"
+{{- end }}
+
+# Elaborate the design only, which is enough to resolve the objects the constraints refer to.
+synth_design -rtl -top {{ .Name }} -include_dirs {{ .IncDir }} {{ if .OutOfContext }}-mode out_of_context{{ end }}
+
+check_timing -file "{{ .Report }}"
+report_exceptions -append -file "{{ .Report }}"
+
+set critical [get_msg_config -count -severity {CRITICAL WARNING}]
+if {\$critical > 0} {
+    error "constraint check failed with \$critical critical warnings"
+}
+EOF
+    vivado -mode batch -nolog -nojournal -notrace -source check_constraints.tcl | tee {{ .VivadoLog }} | ( grep -E "^(ERROR|WARNING|CRITICAL)" || true )
+)
+
+rm -rf ${TMPDIR}
+`
+
+// Check the timing constraints of a design without running a full synthesis. The design is only
+// elaborated, so that malformed constraints or constraints referring to unknown objects are found
+// early. IP checkpoints are not read, so the constraints must not refer to objects inside them.
+type ConstraintCheck struct {
+	// Name of the top-level module
+	Name string
+
+	// RTL sources of the design
+	Srcs []core.Path
+
+	// Constraint definitions files to check
+	Constraints []core.Path
+
+	// IP blocks whose RTL sources and constraints are included
+	Ips []hdl.Ip
+
+	// Check the constraints for an out-of-context synthesis run
+	OutOfContext bool
+
+	// List of directories with board definitions, in addition to the ones from the xilinx-board-files flag
+	BoardFiles []core.Path
+}
+
+// Report returns the file holding the check_timing and report_exceptions output.
+func (rule ConstraintCheck) Report(ctx core.Context) core.OutPath {
+	return ctx.Cwd().WithSuffix("/" + rule.Name + "_constraints.rpt")
+}
+
+func (rule ConstraintCheck) Build(ctx core.Context) {
+	rtls := []core.Path{}
+	constrs := []core.Path{}
+	for _, ip := range hdl.FlattenIpGraph(rule.Ips) {
+		for _, src := range ip.Sources() {
+			if hdl.IsRtl(src.String()) {
+				rtls = append(rtls, src)
+			} else if hdl.IsConstraint(src.String()) {
+				constrs = append(constrs, src)
+			}
+		}
+	}
+	rtls = append(rtls, rule.Srcs...)
+	constrs = append(constrs, rule.Constraints...)
+
+	verilogs := []core.Path{}
+	vhdls := []core.Path{}
+	for _, rtl := range rtls {
+		if hdl.IsVhdl(rtl.String()) {
+			vhdls = append(vhdls, rtl)
+		} else {
+			verilogs = append(verilogs, rtl)
+		}
+	}
+
+	report := rule.Report(ctx)
+	vivadoLog := report.WithSuffix(".vivado.log")
+
+	data := ConstraintCheckScriptParams{
+		Name:         rule.Name,
+		PartName:     hdl.PartName.Value(),
+		BoardFiles:   boardFiles(rule.BoardFiles),
+		IncDir:       core.SourcePath(""),
+		Rtls:         verilogs,
+		Vhdls:        vhdls,
+		Constrs:      constrs,
+		OutOfContext: rule.OutOfContext,
+		Report:       report,
+		VivadoLog:    vivadoLog,
+		TmpDirScript: tmpDirScript(ctx.TempDir(report, vivadoLog)),
+	}
+
+	ctx.AddBuildStep(core.BuildStep{
+		Outs:   []core.OutPath{report, vivadoLog},
+		Ins:    append(rtls, constrs...),
+		Script: core.CompileTemplate(constraintCheckScript, "constraint-check-script", data),
+		Descr:  fmt.Sprintf("Checking constraints of %s", rule.Name),
+	})
+}
@@ -19,6 +19,9 @@ type DeviceTreeScriptParams struct {
 	BoardDts       core.Path
 	HwDef          core.Path
 	DeviceTreeXlnx core.Path
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
 var deviceTreeScript = `#!/bin/bash
@@ -26,8 +29,7 @@ set -eu -o pipefail
 
 set -eu -o pipefail
 
-TMPDIR=$(mktemp -d -t ci-XXXXXXXXXX)
-
+{{ .TmpDirScript }}
 (
     cd ${TMPDIR}
     cp {{ .HwDef }} design.hwdef
@@ -94,6 +96,7 @@ func (rule DeviceTree) Build(ctx core.Context) {
 		BoardDts:       boardDts,
 		HwDef:          hwdef,
 		DeviceTreeXlnx: core.SourcePath("device-tree-xlnx"),
+		TmpDirScript:   tmpDirScript(ctx.TempDir(rule.Out)),
 	}
 
 	ctx.AddBuildStep(core.BuildStep{
@@ -19,13 +19,15 @@ type HandoffScriptParams struct {
 	Fsbl       core.Path
 	PmuFw      core.Path
 	Patch      core.Path
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
 var handoffScript = `#!/bin/bash
 set -eu -o pipefail
 
-TMPDIR=$(mktemp -d -t ci-XXXXXXXXXX)
-
+{{ .TmpDirScript }}
 (
     cd ${TMPDIR}
     cp {{ .HwDef }} design.hwdef
@@ -95,19 +97,20 @@ func (rule Handoff) Build(ctx core.Context) {
 		}
 	}
 
-	data := HandoffScriptParams{
-		HwDef:      hwdef,
-		EmbeddedSw: core.SourcePath("embeddedsw"),
-		Fsbl:       rule.Fsbl,
-		PmuFw:      rule.PmuFw,
-		Patch:      patch,
-	}
-
 	outs := []core.OutPath{
 		rule.Fsbl,
 		rule.PmuFw,
 	}
 
+	data := HandoffScriptParams{
+		HwDef:        hwdef,
+		EmbeddedSw:   core.SourcePath("embeddedsw"),
+		Fsbl:         rule.Fsbl,
+		PmuFw:        rule.PmuFw,
+		Patch:        patch,
+		TmpDirScript: tmpDirScript(ctx.TempDir(outs...)),
+	}
+
 	ctx.AddBuildStep(core.BuildStep{
 		Outs:   outs,
 		In:     hwdef,
@@ -2,6 +2,8 @@ package xilinx
 
 import (
 	"fmt"
+	"path"
+	"sort"
 
 	"dbt-rules/RULES/core"
 	"dbt-rules/RULES/hdl"
@@ -13,20 +15,30 @@ func init() {
 }
 
 type IpScriptParams struct {
-	PartName   string
-	BoardName  string
-	Name       string
-	Design     core.Path
-	XciPath    string
-	OutSim     core.OutPath
-	OutXci     core.OutPath
-	BoardFiles []core.Path
-	SimScripts map[string]core.Path
-	DataFiles  map[string]core.OutPath
-	Verbose    bool
+	// Stage is "xci" to generate the XCI checkpoint and project archive, or "sim" to generate
+	// the simulation artifacts from the project sources of the "xci" stage.
+	Stage          string
+	PartName       string
+	BoardName      string
+	Name           string
+	Design         core.Path
+	XciPath        string
+	OutSim         core.OutPath
+	OutXci         core.OutPath
+	ProjectArchive core.OutPath
+	BoardFiles     []string
+	SimScripts     map[string]core.Path
+	VivadoLog      core.OutPath
+	Verbose        bool
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
-// Create an IP checkpoint, simulation artifacts, and optionally other data
+// Create an IP checkpoint, simulation artifacts, and optionally other data. The checkpoint is
+// generated by one build step together with an archive of the Vivado project, from which the
+// simulation artifacts and each data file are extracted by a build step of their own, so that any
+// of them can be built on its own, e.g. by passing its output path to ninja.
 type Ip struct {
 	// Name of the module as specified in the design file
 	ModuleName string
@@ -43,7 +55,7 @@ type Ip struct {
 	// Optional XCI path relative to the output directory generated by Vivado, if different from the dufault
 	XciPath string
 
-	// List of directories with board definitions
+	// List of directories with board definitions, in addition to the ones from the xilinx-board-files flag
 	BoardFiles []core.Path
 
 	// Map of scripts for loading the IP into a simulator. The key is the name of the simulator or "generic-sim".
@@ -55,6 +67,23 @@ type Ip struct {
 	Verbose   bool
 }
 
+// VivadoLog returns the file holding the full Vivado output of the XCI generation.
+func (rule Ip) VivadoLog() core.OutPath {
+	return rule.OutXci.WithSuffix(".vivado.log")
+}
+
+// SimVivadoLog returns the file holding the full Vivado output of the simulation artifacts
+// generation.
+func (rule Ip) SimVivadoLog() core.OutPath {
+	return rule.OutSim.WithSuffix(".vivado.log")
+}
+
+// projectArchive returns the archive of the Vivado project sources, which is passed from the
+// XCI generation to the simulation artifacts generation.
+func (rule Ip) projectArchive() core.OutPath {
+	return rule.OutXci.WithSuffix(".project.tar.gz")
+}
+
 func (rule Ip) Build(ctx core.Context) {
 	xciPath := rule.XciPath
 	if xciPath == "" {
@@ -62,25 +91,53 @@ func (rule Ip) Build(ctx core.Context) {
 	}
 
 	data := IpScriptParams{
-		PartName:   hdl.PartName.Value(),
-		BoardName:  hdl.BoardName.Value(),
-		Name:       rule.ModuleName,
-		Design:     rule.Design,
-		XciPath:    xciPath,
-		OutXci:     rule.OutXci,
-		OutSim:     rule.OutSim,
-		BoardFiles: rule.BoardFiles,
-		SimScripts: rule.SimScripts,
-		DataFiles:  rule.DataFiles,
-		Verbose:    rule.Verbose,
+		Stage:          "xci",
+		PartName:       hdl.PartName.Value(),
+		BoardName:      hdl.BoardName.Value(),
+		Name:           rule.ModuleName,
+		Design:         rule.Design,
+		XciPath:        xciPath,
+		OutXci:         rule.OutXci,
+		OutSim:         rule.OutSim,
+		ProjectArchive: rule.projectArchive(),
+		BoardFiles:     boardFiles(rule.BoardFiles),
+		SimScripts:     rule.SimScripts,
+		VivadoLog:      rule.VivadoLog(),
+		Verbose:        rule.Verbose,
+		TmpDirScript:   tmpDirScript(ctx.TempDir(rule.OutXci)),
 	}
 
 	ctx.AddBuildStep(core.BuildStep{
-		Outs:   append([]core.OutPath{rule.OutXci, rule.OutSim}, core.GetSortedOutPaths(rule.DataFiles)...),
-		Ins:    append([]core.Path{rule.Design}, core.GetSortedPaths(rule.SimScripts)...),
+		Outs:   []core.OutPath{rule.OutXci, rule.projectArchive(), rule.VivadoLog()},
+		In:     rule.Design,
 		Script: core.CompileTemplateFile(h.XilinxIpScriptTmpl.String(), data),
 		Descr:  fmt.Sprintf("Generating IP from %s", rule.Design.Relative()),
 	})
+
+	data.Stage = "sim"
+	data.VivadoLog = rule.SimVivadoLog()
+	data.TmpDirScript = tmpDirScript(ctx.TempDir(rule.OutSim))
+	ctx.AddBuildStep(core.BuildStep{
+		Outs:   []core.OutPath{rule.OutSim, rule.SimVivadoLog()},
+		Ins:    append([]core.Path{rule.projectArchive()}, core.GetSortedPaths(rule.SimScripts)...),
+		Script: core.CompileTemplateFile(h.XilinxIpScriptTmpl.String(), data),
+		Descr:  fmt.Sprintf("Generating IP simulation artifacts from %s", rule.Design.Relative()),
+	})
+
+	ins := []string{}
+	for in := range rule.DataFiles {
+		ins = append(ins, in)
+	}
+	sort.Strings(ins)
+	for _, in := range ins {
+		out := rule.DataFiles[in]
+		ctx.AddBuildStep(core.BuildStep{
+			Out:   out,
+			In:    rule.projectArchive(),
+			Cmd:   fmt.Sprintf("tar xzf %q -O %q > %q", rule.projectArchive(), "./"+path.Clean(in), out),
+			Descr: fmt.Sprintf("Extracting IP data file %s", out.Relative()),
+		})
+	}
 }
 
 func (rule Ip) Sources() []core.Path {
@@ -34,7 +34,7 @@ type SynthOutOfContext struct {
 	// Constraint definitions file for the design.
 	Constraints core.Path
 
-	// List of directories with board definitions
+	// List of directories with board definitions, in addition to the ones from the xilinx-board-files flag
 	BoardFiles []core.Path
 }
 
@@ -103,7 +103,7 @@ func (rule SynthOutOfContext) Build(ctx core.Context) {
 		OutOfContext:    true,
 		PartName:        hdl.PartName.Value(),
 		BoardName:       hdl.BoardName.Value(),
-		BoardFiles:      rule.BoardFiles,
+		BoardFiles:      boardFiles(rule.BoardFiles),
 		IncDir:          core.SourcePath(""),
 		Ips:             ips,
 		Rtls:            rtls,
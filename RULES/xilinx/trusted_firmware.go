@@ -13,12 +13,15 @@ func init() {
 type AtfScriptParams struct {
 	Bl31 core.Path
 	Repo core.Path
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
 var atfScript = `#!/bin/bash
 set -eu -o pipefail
 
-TMPDIR=$(mktemp -d -t ci-XXXXXXXXXX)
+{{ .TmpDirScript }}
 rsync --exclude=.git -az {{ .Repo }} ${TMPDIR}
 (
     cd ${TMPDIR}/arm-trusted-firmware-xlnx
@@ -38,6 +41,8 @@ func (rule ArmTrustedFirmware) Build(ctx core.Context) {
 	data := AtfScriptParams{
 		Bl31: rule.Bl31,
 		Repo: core.SourcePath("arm-trusted-firmware-xlnx"),
+
+		TmpDirScript: tmpDirScript(ctx.TempDir(rule.Bl31)),
 	}
 	ctx.AddBuildStep(core.BuildStep{
 		Out:    rule.Bl31,
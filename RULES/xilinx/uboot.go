@@ -16,12 +16,15 @@ type UBootScriptParams struct {
 	Out    core.OutPath
 	Repo   core.Path
 	Config string
+
+	// TmpDirScript creates the temporary directory of the step, see tmpDirScript.
+	TmpDirScript string
 }
 
 var uBootScript = `#!/bin/bash
 set -eu -o pipefail
 
-TMPDIR=$(mktemp -d -t ci-XXXXXXXXXX)
+{{ .TmpDirScript }}
 rsync --exclude=.git -az {{ .Repo }} ${TMPDIR}
 (
     cd ${TMPDIR}/u-boot
@@ -62,6 +65,8 @@ func (rule UBoot) Build(ctx core.Context) {
 		Out:    rule.Out,
 		Repo:   core.SourcePath("u-boot"),
 		Config: config,
+
+		TmpDirScript: tmpDirScript(ctx.TempDir(rule.Out)),
 	}
 
 	ctx.AddBuildStep(core.BuildStep{